@@ -4,6 +4,9 @@ import "strings"
 
 // Addr represents a network end point address.
 // It's MAC address on Linux or Device UUID on OS X.
+//
+// The Addrs created by NewAddr are comparable, and can be used as map keys.
+// Two Addrs of the same end point have the same String, in lower case.
 type Addr interface {
 	String() string
 }
@@ -0,0 +1,34 @@
+package ble
+
+import "testing"
+
+func TestNewAddr(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{"aa:bb:cc:dd:ee:ff", "aa:bb:cc:dd:ee:ff"},
+		{"AA:BB:CC:DD:EE:FF", "aa:bb:cc:dd:ee:ff"},
+		{"Aa:bB:0c:D1:e2:Ff", "aa:bb:0c:d1:e2:ff"},
+		{"34DA3AD1-7110-41A1-B1EF-4430F509CDE7", "34da3ad1-7110-41a1-b1ef-4430f509cde7"},
+	} {
+		a := NewAddr(tc.s)
+		if s := a.String(); s != tc.want {
+			t.Errorf("NewAddr(%q).String() = %q, want %q", tc.s, s, tc.want)
+		}
+		// The string of an Addr makes the same Addr.
+		if b := NewAddr(a.String()); b != a {
+			t.Errorf("NewAddr(%q) = %v, want %v", a.String(), b, a)
+		}
+	}
+}
+
+func TestAddrMapKey(t *testing.T) {
+	m := map[Addr]int{}
+	m[NewAddr("AA:BB:CC:DD:EE:FF")]++
+	m[NewAddr("aa:bb:cc:dd:ee:ff")]++
+	m[NewAddr("11:22:33:44:55:66")]++
+	if len(m) != 2 || m[NewAddr("aa:bb:cc:dd:ee:ff")] != 2 {
+		t.Errorf("got %v, want 2 addresses, with aa:bb:cc:dd:ee:ff counted twice", m)
+	}
+}
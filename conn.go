@@ -37,3 +37,12 @@ type Conn interface {
 	// Disconnected returns a receiving channel, which is closed when the connection disconnects.
 	Disconnected() <-chan struct{}
 }
+
+// ConnParams are the connection parameters, which a slave may request the
+// master to use with a Connection Parameter Update Request [Vol 3, Part A, 4.20].
+type ConnParams struct {
+	IntervalMin       uint16 // 0x0006 - 0x0C80; N * 1.25 msec
+	IntervalMax       uint16 // 0x0006 - 0x0C80; N * 1.25 msec
+	SlaveLatency      uint16 // 0x0000 - 0x01F3; number of connection events
+	TimeoutMultiplier uint16 // 0x000A - 0x0C80; N * 10 msec
+}
@@ -21,6 +21,7 @@ var (
 	IncludeUUID          = UUID16(0x2802)
 	CharacteristicUUID   = UUID16(0x2803)
 
+	UserDescriptionUUID            = UUID16(0x2901)
 	ClientCharacteristicConfigUUID = UUID16(0x2902)
 	ServerCharacteristicConfigUUID = UUID16(0x2903)
 
@@ -30,4 +31,9 @@ var (
 	ReconnectionAddrUUID  = UUID16(0x2A03)
 	PeferredParamsUUID    = UUID16(0x2A04)
 	ServiceChangedUUID    = UUID16(0x2A05)
+	BatteryLevelUUID      = UUID16(0x2A19)
+
+	ClientSupportedFeaturesUUID = UUID16(0x2B29)
+	DatabaseHashUUID            = UUID16(0x2B2A)
+	ServerSupportedFeaturesUUID = UUID16(0x2B3A)
 )
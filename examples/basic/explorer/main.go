@@ -80,11 +80,11 @@ func main() {
 
 func explore(cln ble.Client, p *ble.Profile) error {
 	for _, s := range p.Services {
-		fmt.Printf("    Service: %s %s, Handle (0x%02X)\n", s.UUID, ble.Name(s.UUID), s.Handle)
+		fmt.Printf("    Service: %s, Handle (0x%02X)\n", label(s.UUID), s.Handle)
 
 		for _, c := range s.Characteristics {
-			fmt.Printf("      Characteristic: %s %s, Property: 0x%02X (%s), Handle(0x%02X), VHandle(0x%02X)\n",
-				c.UUID, ble.Name(c.UUID), c.Property, propString(c.Property), c.Handle, c.ValueHandle)
+			fmt.Printf("      Characteristic: %s, Property: 0x%02X (%s), Handle(0x%02X), VHandle(0x%02X)\n",
+				label(c.UUID), c.Property, propString(c.Property), c.Handle, c.ValueHandle)
 			if (c.Property & ble.CharRead) != 0 {
 				b, err := cln.ReadCharacteristic(c)
 				if err != nil {
@@ -95,7 +95,7 @@ func explore(cln ble.Client, p *ble.Profile) error {
 			}
 
 			for _, d := range c.Descriptors {
-				fmt.Printf("        Descriptor: %s %s, Handle(0x%02x)\n", d.UUID, ble.Name(d.UUID), d.Handle)
+				fmt.Printf("        Descriptor: %s, Handle(0x%02x)\n", label(d.UUID), d.Handle)
 				b, err := cln.ReadDescriptor(d)
 				if err != nil {
 					fmt.Printf("Failed to read descriptor: %s\n", err)
@@ -150,6 +150,14 @@ func explore(cln ble.Client, p *ble.Profile) error {
 	return nil
 }
 
+// label returns u followed by its name, if it's a known UUID.
+func label(u ble.UUID) string {
+	if n := ble.Name(u); n != u.String() {
+		return u.String() + " " + n
+	}
+	return u.String()
+}
+
 func propString(p ble.Property) string {
 	var s string
 	for k, v := range map[ble.Property]string{
@@ -8,6 +8,11 @@ import (
 )
 
 // A ReadHandler handles GATT requests.
+//
+// A ReadHandler that writes nothing, and leaves the status as ErrSuccess,
+// responds with a legitimately empty value. If there is no value to return,
+// it should set an error status instead, e.g. ErrAttrNotFound, so the client
+// receives an Error Response rather than an ambiguous empty value.
 type ReadHandler interface {
 	ServeRead(req Request, rsp ResponseWriter)
 }
@@ -69,6 +74,30 @@ func (r *request) Conn() Conn   { return r.conn }
 func (r *request) Data() []byte { return r.data }
 func (r *request) Offset() int  { return r.offset }
 
+// AttributeRequest is a Request, which also identifies the attribute requested.
+// It allows a handler shared by multiple attributes to tell them apart.
+// The requests passed by the ATT server implement it.
+type AttributeRequest interface {
+	Request
+	Handle() uint16
+	UUID() UUID
+}
+
+// NewAttributeRequest returns a default implementation of AttributeRequest.
+func NewAttributeRequest(conn Conn, data []byte, offset int, h uint16, u UUID) AttributeRequest {
+	return &attributeRequest{request: request{conn: conn, data: data, offset: offset}, h: h, u: u}
+}
+
+// Default implementation of AttributeRequest.
+type attributeRequest struct {
+	request
+	h uint16
+	u UUID
+}
+
+func (r *attributeRequest) Handle() uint16 { return r.h }
+func (r *attributeRequest) UUID() UUID     { return r.u }
+
 // ResponseWriter ...
 type ResponseWriter interface {
 	// Write writes data to return as the characteristic value.
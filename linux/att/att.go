@@ -12,6 +12,26 @@ var (
 	// ErrSeqProtoTimeout means the request hasn't been acknowledged in 30 seconds.
 	// [Vol 3, Part F, 3.3.3]
 	ErrSeqProtoTimeout = errors.New("req timeout")
+
+	// ErrIndicationCancelled means the indication has been cancelled before it's confirmed.
+	ErrIndicationCancelled = errors.New("indication cancelled")
+
+	// ErrTransactionInProgress means a request has been issued, while another
+	// one is waiting for its response. [Vol 3, Part F, 3.3.2]
+	ErrTransactionInProgress = errors.New("transaction in progress")
+
+	// ErrServerClosed means the server has been closed, along with its connection.
+	ErrServerClosed = errors.New("server closed")
+
+	// ErrNotSubscribed means the remote central hasn't subscribed to the
+	// notifications or indications of the characteristic.
+	ErrNotSubscribed = errors.New("not subscribed")
+
+	// ErrValueTooLong means the value can't fit in a single PDU for the ATT_MTU.
+	ErrValueTooLong = errors.New("value too long")
+
+	// ErrUnsupported means the operation is not supported by the underlying connection.
+	ErrUnsupported = errors.New("unsupported")
 )
 
 var rspOfReq = map[byte]byte{
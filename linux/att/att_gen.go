@@ -1,6 +1,10 @@
 package att
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+
+	"github.com/currantlabs/ble"
+)
 
 // ErrorResponseCode ...
 const ErrorResponseCode = 0x01
@@ -8,632 +12,884 @@ const ErrorResponseCode = 0x01
 // ErrorResponse implements Error Response (0x01) [Vol 3, Part E, 3.4.1.1].
 type ErrorResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ErrorResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x01.
 func (r ErrorResponse) SetAttributeOpcode() { r[0] = 0x01 }
 
-// RequestOpcodeInError ...
+// RequestOpcodeInError returns the Request Opcode In Error field.
 func (r ErrorResponse) RequestOpcodeInError() uint8 { return r[1] }
 
-// SetRequestOpcodeInError ...
+// SetRequestOpcodeInError sets the Request Opcode In Error field.
 func (r ErrorResponse) SetRequestOpcodeInError(v uint8) { r[1] = v }
 
-// AttributeInError ...
+// AttributeInError returns the Attribute In Error field.
 func (r ErrorResponse) AttributeInError() uint16 { return binary.LittleEndian.Uint16(r[2:]) }
 
-// SetAttributeInError ...
+// SetAttributeInError sets the Attribute In Error field.
 func (r ErrorResponse) SetAttributeInError(v uint16) { binary.LittleEndian.PutUint16(r[2:], v) }
 
-// ErrorCode ...
+// ErrorCode returns the Error Code field.
 func (r ErrorResponse) ErrorCode() uint8 { return r[4] }
 
-// SetErrorCode ...
+// SetErrorCode sets the Error Code field.
 func (r ErrorResponse) SetErrorCode(v uint8) { r[4] = v }
 
+// NewErrorResponse validates the length and opcode of b, and returns it as ErrorResponse.
+// It returns ble.ErrInvalidPDU if b isn't 5 bytes long, or the opcode isn't 0x01.
+func NewErrorResponse(b []byte) (ErrorResponse, error) {
+	if len(b) != 5 || b[0] != 0x01 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ErrorResponse(b), nil
+}
+
 // ExchangeMTURequestCode ...
 const ExchangeMTURequestCode = 0x02
 
 // ExchangeMTURequest implements Exchange MTU Request (0x02) [Vol 3, Part E, 3.4.2.1].
 type ExchangeMTURequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ExchangeMTURequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x02.
 func (r ExchangeMTURequest) SetAttributeOpcode() { r[0] = 0x02 }
 
-// ClientRxMTU ...
+// ClientRxMTU returns the Client Rx MTU field.
 func (r ExchangeMTURequest) ClientRxMTU() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetClientRxMTU ...
+// SetClientRxMTU sets the Client Rx MTU field.
 func (r ExchangeMTURequest) SetClientRxMTU(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
+// NewExchangeMTURequest validates the length and opcode of b, and returns it as ExchangeMTURequest.
+// It returns ble.ErrInvalidPDU if b isn't 3 bytes long, or the opcode isn't 0x02.
+func NewExchangeMTURequest(b []byte) (ExchangeMTURequest, error) {
+	if len(b) != 3 || b[0] != 0x02 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ExchangeMTURequest(b), nil
+}
+
 // ExchangeMTUResponseCode ...
 const ExchangeMTUResponseCode = 0x03
 
 // ExchangeMTUResponse implements Exchange MTU Response (0x03) [Vol 3, Part E, 3.4.2.2].
 type ExchangeMTUResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ExchangeMTUResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x03.
 func (r ExchangeMTUResponse) SetAttributeOpcode() { r[0] = 0x03 }
 
-// ServerRxMTU ...
+// ServerRxMTU returns the Server Rx MTU field.
 func (r ExchangeMTUResponse) ServerRxMTU() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetServerRxMTU ...
+// SetServerRxMTU sets the Server Rx MTU field.
 func (r ExchangeMTUResponse) SetServerRxMTU(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
+// NewExchangeMTUResponse validates the length and opcode of b, and returns it as ExchangeMTUResponse.
+// It returns ble.ErrInvalidPDU if b isn't 3 bytes long, or the opcode isn't 0x03.
+func NewExchangeMTUResponse(b []byte) (ExchangeMTUResponse, error) {
+	if len(b) != 3 || b[0] != 0x03 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ExchangeMTUResponse(b), nil
+}
+
 // FindInformationRequestCode ...
 const FindInformationRequestCode = 0x04
 
 // FindInformationRequest implements Find Information Request (0x04) [Vol 3, Part E, 3.4.3.1].
 type FindInformationRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r FindInformationRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x04.
 func (r FindInformationRequest) SetAttributeOpcode() { r[0] = 0x04 }
 
-// StartingHandle ...
+// StartingHandle returns the Starting Handle field.
 func (r FindInformationRequest) StartingHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetStartingHandle ...
+// SetStartingHandle sets the Starting Handle field.
 func (r FindInformationRequest) SetStartingHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// EndingHandle ...
+// EndingHandle returns the Ending Handle field.
 func (r FindInformationRequest) EndingHandle() uint16 { return binary.LittleEndian.Uint16(r[3:]) }
 
-// SetEndingHandle ...
+// SetEndingHandle sets the Ending Handle field.
 func (r FindInformationRequest) SetEndingHandle(v uint16) { binary.LittleEndian.PutUint16(r[3:], v) }
 
+// NewFindInformationRequest validates the length and opcode of b, and returns it as FindInformationRequest.
+// It returns ble.ErrInvalidPDU if b isn't 5 bytes long, or the opcode isn't 0x04.
+func NewFindInformationRequest(b []byte) (FindInformationRequest, error) {
+	if len(b) != 5 || b[0] != 0x04 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return FindInformationRequest(b), nil
+}
+
 // FindInformationResponseCode ...
 const FindInformationResponseCode = 0x05
 
 // FindInformationResponse implements Find Information Response (0x05) [Vol 3, Part E, 3.4.3.2].
 type FindInformationResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r FindInformationResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x05.
 func (r FindInformationResponse) SetAttributeOpcode() { r[0] = 0x05 }
 
-// Format ...
+// Format returns the Format field.
 func (r FindInformationResponse) Format() uint8 { return r[1] }
 
-// SetFormat ...
+// SetFormat sets the Format field.
 func (r FindInformationResponse) SetFormat(v uint8) { r[1] = v }
 
-// InformationData ...
+// InformationData returns the Information Data field.
 func (r FindInformationResponse) InformationData() []byte { return r[2:] }
 
-// SetInformationData ...
+// SetInformationData sets the Information Data field.
 func (r FindInformationResponse) SetInformationData(v []byte) { copy(r[2:], v) }
 
+// NewFindInformationResponse validates the length and opcode of b, and returns it as FindInformationResponse.
+// It returns ble.ErrInvalidPDU if b is shorter than 2 bytes, or the opcode isn't 0x05.
+func NewFindInformationResponse(b []byte) (FindInformationResponse, error) {
+	if len(b) < 2 || b[0] != 0x05 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return FindInformationResponse(b), nil
+}
+
 // FindByTypeValueRequestCode ...
 const FindByTypeValueRequestCode = 0x06
 
 // FindByTypeValueRequest implements Find By Type Value Request (0x06) [Vol 3, Part E, 3.4.3.3].
 type FindByTypeValueRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r FindByTypeValueRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x06.
 func (r FindByTypeValueRequest) SetAttributeOpcode() { r[0] = 0x06 }
 
-// StartingHandle ...
+// StartingHandle returns the Starting Handle field.
 func (r FindByTypeValueRequest) StartingHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetStartingHandle ...
+// SetStartingHandle sets the Starting Handle field.
 func (r FindByTypeValueRequest) SetStartingHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// EndingHandle ...
+// EndingHandle returns the Ending Handle field.
 func (r FindByTypeValueRequest) EndingHandle() uint16 { return binary.LittleEndian.Uint16(r[3:]) }
 
-// SetEndingHandle ...
+// SetEndingHandle sets the Ending Handle field.
 func (r FindByTypeValueRequest) SetEndingHandle(v uint16) { binary.LittleEndian.PutUint16(r[3:], v) }
 
-// AttributeType ...
+// AttributeType returns the Attribute Type field.
 func (r FindByTypeValueRequest) AttributeType() uint16 { return binary.LittleEndian.Uint16(r[5:]) }
 
-// SetAttributeType ...
+// SetAttributeType sets the Attribute Type field.
 func (r FindByTypeValueRequest) SetAttributeType(v uint16) { binary.LittleEndian.PutUint16(r[5:], v) }
 
-// AttributeValue ...
+// AttributeValue returns the Attribute Value field.
 func (r FindByTypeValueRequest) AttributeValue() []byte { return r[7:] }
 
-// SetAttributeValue ...
+// SetAttributeValue sets the Attribute Value field.
 func (r FindByTypeValueRequest) SetAttributeValue(v []byte) { copy(r[7:], v) }
 
+// NewFindByTypeValueRequest validates the length and opcode of b, and returns it as FindByTypeValueRequest.
+// It returns ble.ErrInvalidPDU if b is shorter than 7 bytes, or the opcode isn't 0x06.
+func NewFindByTypeValueRequest(b []byte) (FindByTypeValueRequest, error) {
+	if len(b) < 7 || b[0] != 0x06 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return FindByTypeValueRequest(b), nil
+}
+
 // FindByTypeValueResponseCode ...
 const FindByTypeValueResponseCode = 0x07
 
 // FindByTypeValueResponse implements Find By Type Value Response (0x07) [Vol 3, Part E, 3.4.3.4].
 type FindByTypeValueResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r FindByTypeValueResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x07.
 func (r FindByTypeValueResponse) SetAttributeOpcode() { r[0] = 0x07 }
 
-// HandleInformationList ...
+// HandleInformationList returns the Handle Information List field.
 func (r FindByTypeValueResponse) HandleInformationList() []byte { return r[1:] }
 
-// SetHandleInformationList ...
+// SetHandleInformationList sets the Handle Information List field.
 func (r FindByTypeValueResponse) SetHandleInformationList(v []byte) { copy(r[1:], v) }
 
+// NewFindByTypeValueResponse validates the length and opcode of b, and returns it as FindByTypeValueResponse.
+// It returns ble.ErrInvalidPDU if b is shorter than 1 bytes, or the opcode isn't 0x07.
+func NewFindByTypeValueResponse(b []byte) (FindByTypeValueResponse, error) {
+	if len(b) < 1 || b[0] != 0x07 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return FindByTypeValueResponse(b), nil
+}
+
 // ReadByTypeRequestCode ...
 const ReadByTypeRequestCode = 0x08
 
 // ReadByTypeRequest implements Read By Type Request (0x08) [Vol 3, Part E, 3.4.4.1].
 type ReadByTypeRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadByTypeRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x08.
 func (r ReadByTypeRequest) SetAttributeOpcode() { r[0] = 0x08 }
 
-// StartingHandle ...
+// StartingHandle returns the Starting Handle field.
 func (r ReadByTypeRequest) StartingHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetStartingHandle ...
+// SetStartingHandle sets the Starting Handle field.
 func (r ReadByTypeRequest) SetStartingHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// EndingHandle ...
+// EndingHandle returns the Ending Handle field.
 func (r ReadByTypeRequest) EndingHandle() uint16 { return binary.LittleEndian.Uint16(r[3:]) }
 
-// SetEndingHandle ...
+// SetEndingHandle sets the Ending Handle field.
 func (r ReadByTypeRequest) SetEndingHandle(v uint16) { binary.LittleEndian.PutUint16(r[3:], v) }
 
-// AttributeType ...
+// AttributeType returns the Attribute Type field.
 func (r ReadByTypeRequest) AttributeType() []byte { return r[5:] }
 
-// SetAttributeType ...
+// SetAttributeType sets the Attribute Type field.
 func (r ReadByTypeRequest) SetAttributeType(v []byte) { copy(r[5:], v) }
 
+// NewReadByTypeRequest validates the length and opcode of b, and returns it as ReadByTypeRequest.
+// It returns ble.ErrInvalidPDU if b is shorter than 5 bytes, or the opcode isn't 0x08.
+func NewReadByTypeRequest(b []byte) (ReadByTypeRequest, error) {
+	if len(b) < 5 || b[0] != 0x08 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadByTypeRequest(b), nil
+}
+
 // ReadByTypeResponseCode ...
 const ReadByTypeResponseCode = 0x09
 
 // ReadByTypeResponse implements Read By Type Response (0x09) [Vol 3, Part E, 3.4.4.2].
 type ReadByTypeResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadByTypeResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x09.
 func (r ReadByTypeResponse) SetAttributeOpcode() { r[0] = 0x09 }
 
-// Length ...
+// Length returns the Length field.
 func (r ReadByTypeResponse) Length() uint8 { return r[1] }
 
-// SetLength ...
+// SetLength sets the Length field.
 func (r ReadByTypeResponse) SetLength(v uint8) { r[1] = v }
 
-// AttributeDataList ...
+// AttributeDataList returns the Attribute Data List field.
 func (r ReadByTypeResponse) AttributeDataList() []byte { return r[2:] }
 
-// SetAttributeDataList ...
+// SetAttributeDataList sets the Attribute Data List field.
 func (r ReadByTypeResponse) SetAttributeDataList(v []byte) { copy(r[2:], v) }
 
+// NewReadByTypeResponse validates the length and opcode of b, and returns it as ReadByTypeResponse.
+// It returns ble.ErrInvalidPDU if b is shorter than 2 bytes, or the opcode isn't 0x09.
+func NewReadByTypeResponse(b []byte) (ReadByTypeResponse, error) {
+	if len(b) < 2 || b[0] != 0x09 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadByTypeResponse(b), nil
+}
+
 // ReadRequestCode ...
 const ReadRequestCode = 0x0A
 
 // ReadRequest implements Read Request (0x0A) [Vol 3, Part E, 3.4.4.3].
 type ReadRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x0A.
 func (r ReadRequest) SetAttributeOpcode() { r[0] = 0x0A }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r ReadRequest) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r ReadRequest) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
+// NewReadRequest validates the length and opcode of b, and returns it as ReadRequest.
+// It returns ble.ErrInvalidPDU if b isn't 3 bytes long, or the opcode isn't 0x0A.
+func NewReadRequest(b []byte) (ReadRequest, error) {
+	if len(b) != 3 || b[0] != 0x0A {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadRequest(b), nil
+}
+
 // ReadResponseCode ...
 const ReadResponseCode = 0x0B
 
 // ReadResponse implements Read Response (0x0B) [Vol 3, Part E, 3.4.4.4].
 type ReadResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x0B.
 func (r ReadResponse) SetAttributeOpcode() { r[0] = 0x0B }
 
-// AttributeValue ...
+// AttributeValue returns the Attribute Value field.
 func (r ReadResponse) AttributeValue() []byte { return r[1:] }
 
-// SetAttributeValue ...
+// SetAttributeValue sets the Attribute Value field.
 func (r ReadResponse) SetAttributeValue(v []byte) { copy(r[1:], v) }
 
+// NewReadResponse validates the length and opcode of b, and returns it as ReadResponse.
+// It returns ble.ErrInvalidPDU if b is shorter than 1 bytes, or the opcode isn't 0x0B.
+func NewReadResponse(b []byte) (ReadResponse, error) {
+	if len(b) < 1 || b[0] != 0x0B {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadResponse(b), nil
+}
+
 // ReadBlobRequestCode ...
 const ReadBlobRequestCode = 0x0C
 
 // ReadBlobRequest implements Read Blob Request (0x0C) [Vol 3, Part E, 3.4.4.5].
 type ReadBlobRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadBlobRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x0C.
 func (r ReadBlobRequest) SetAttributeOpcode() { r[0] = 0x0C }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r ReadBlobRequest) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r ReadBlobRequest) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// ValueOffset ...
+// ValueOffset returns the Value Offset field.
 func (r ReadBlobRequest) ValueOffset() uint16 { return binary.LittleEndian.Uint16(r[3:]) }
 
-// SetValueOffset ...
+// SetValueOffset sets the Value Offset field.
 func (r ReadBlobRequest) SetValueOffset(v uint16) { binary.LittleEndian.PutUint16(r[3:], v) }
 
+// NewReadBlobRequest validates the length and opcode of b, and returns it as ReadBlobRequest.
+// It returns ble.ErrInvalidPDU if b isn't 5 bytes long, or the opcode isn't 0x0C.
+func NewReadBlobRequest(b []byte) (ReadBlobRequest, error) {
+	if len(b) != 5 || b[0] != 0x0C {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadBlobRequest(b), nil
+}
+
 // ReadBlobResponseCode ...
 const ReadBlobResponseCode = 0x0D
 
 // ReadBlobResponse implements Read Blob Response (0x0D) [Vol 3, Part E, 3.4.4.6].
 type ReadBlobResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadBlobResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x0D.
 func (r ReadBlobResponse) SetAttributeOpcode() { r[0] = 0x0D }
 
-// PartAttributeValue ...
+// PartAttributeValue returns the Part Attribute Value field.
 func (r ReadBlobResponse) PartAttributeValue() []byte { return r[1:] }
 
-// SetPartAttributeValue ...
+// SetPartAttributeValue sets the Part Attribute Value field.
 func (r ReadBlobResponse) SetPartAttributeValue(v []byte) { copy(r[1:], v) }
 
+// NewReadBlobResponse validates the length and opcode of b, and returns it as ReadBlobResponse.
+// It returns ble.ErrInvalidPDU if b is shorter than 1 bytes, or the opcode isn't 0x0D.
+func NewReadBlobResponse(b []byte) (ReadBlobResponse, error) {
+	if len(b) < 1 || b[0] != 0x0D {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadBlobResponse(b), nil
+}
+
 // ReadMultipleRequestCode ...
 const ReadMultipleRequestCode = 0x0E
 
 // ReadMultipleRequest implements Read Multiple Request (0x0E) [Vol 3, Part E, 3.4.4.7].
 type ReadMultipleRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadMultipleRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x0E.
 func (r ReadMultipleRequest) SetAttributeOpcode() { r[0] = 0x0E }
 
-// SetOfHandles ...
+// SetOfHandles returns the Set Of Handles field.
 func (r ReadMultipleRequest) SetOfHandles() []byte { return r[1:] }
 
-// SetSetOfHandles ...
+// SetSetOfHandles sets the Set Of Handles field.
 func (r ReadMultipleRequest) SetSetOfHandles(v []byte) { copy(r[1:], v) }
 
+// NewReadMultipleRequest validates the length and opcode of b, and returns it as ReadMultipleRequest.
+// It returns ble.ErrInvalidPDU if b is shorter than 1 bytes, or the opcode isn't 0x0E.
+func NewReadMultipleRequest(b []byte) (ReadMultipleRequest, error) {
+	if len(b) < 1 || b[0] != 0x0E {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadMultipleRequest(b), nil
+}
+
 // ReadMultipleResponseCode ...
 const ReadMultipleResponseCode = 0x0F
 
 // ReadMultipleResponse implements Read Multiple Response (0x0F) [Vol 3, Part E, 3.4.4.8].
 type ReadMultipleResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadMultipleResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x0F.
 func (r ReadMultipleResponse) SetAttributeOpcode() { r[0] = 0x0F }
 
-// SetOfValues ...
+// SetOfValues returns the Set Of Values field.
 func (r ReadMultipleResponse) SetOfValues() []byte { return r[1:] }
 
-// SetSetOfValues ...
+// SetSetOfValues sets the Set Of Values field.
 func (r ReadMultipleResponse) SetSetOfValues(v []byte) { copy(r[1:], v) }
 
+// NewReadMultipleResponse validates the length and opcode of b, and returns it as ReadMultipleResponse.
+// It returns ble.ErrInvalidPDU if b is shorter than 1 bytes, or the opcode isn't 0x0F.
+func NewReadMultipleResponse(b []byte) (ReadMultipleResponse, error) {
+	if len(b) < 1 || b[0] != 0x0F {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadMultipleResponse(b), nil
+}
+
 // ReadByGroupTypeRequestCode ...
 const ReadByGroupTypeRequestCode = 0x10
 
 // ReadByGroupTypeRequest implements Read By Group Type Request (0x10) [Vol 3, Part E, 3.4.4.9].
 type ReadByGroupTypeRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadByGroupTypeRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x10.
 func (r ReadByGroupTypeRequest) SetAttributeOpcode() { r[0] = 0x10 }
 
-// StartingHandle ...
+// StartingHandle returns the Starting Handle field.
 func (r ReadByGroupTypeRequest) StartingHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetStartingHandle ...
+// SetStartingHandle sets the Starting Handle field.
 func (r ReadByGroupTypeRequest) SetStartingHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// EndingHandle ...
+// EndingHandle returns the Ending Handle field.
 func (r ReadByGroupTypeRequest) EndingHandle() uint16 { return binary.LittleEndian.Uint16(r[3:]) }
 
-// SetEndingHandle ...
+// SetEndingHandle sets the Ending Handle field.
 func (r ReadByGroupTypeRequest) SetEndingHandle(v uint16) { binary.LittleEndian.PutUint16(r[3:], v) }
 
-// AttributeGroupType ...
+// AttributeGroupType returns the Attribute Group Type field.
 func (r ReadByGroupTypeRequest) AttributeGroupType() []byte { return r[5:] }
 
-// SetAttributeGroupType ...
+// SetAttributeGroupType sets the Attribute Group Type field.
 func (r ReadByGroupTypeRequest) SetAttributeGroupType(v []byte) { copy(r[5:], v) }
 
+// NewReadByGroupTypeRequest validates the length and opcode of b, and returns it as ReadByGroupTypeRequest.
+// It returns ble.ErrInvalidPDU if b is shorter than 5 bytes, or the opcode isn't 0x10.
+func NewReadByGroupTypeRequest(b []byte) (ReadByGroupTypeRequest, error) {
+	if len(b) < 5 || b[0] != 0x10 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadByGroupTypeRequest(b), nil
+}
+
 // ReadByGroupTypeResponseCode ...
 const ReadByGroupTypeResponseCode = 0x11
 
 // ReadByGroupTypeResponse implements Read By Group Type Response (0x11) [Vol 3, Part E, 3.4.4.10].
 type ReadByGroupTypeResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ReadByGroupTypeResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x11.
 func (r ReadByGroupTypeResponse) SetAttributeOpcode() { r[0] = 0x11 }
 
-// Length ...
+// Length returns the Length field.
 func (r ReadByGroupTypeResponse) Length() uint8 { return r[1] }
 
-// SetLength ...
+// SetLength sets the Length field.
 func (r ReadByGroupTypeResponse) SetLength(v uint8) { r[1] = v }
 
-// AttributeDataList ...
+// AttributeDataList returns the Attribute Data List field.
 func (r ReadByGroupTypeResponse) AttributeDataList() []byte { return r[2:] }
 
-// SetAttributeDataList ...
+// SetAttributeDataList sets the Attribute Data List field.
 func (r ReadByGroupTypeResponse) SetAttributeDataList(v []byte) { copy(r[2:], v) }
 
+// NewReadByGroupTypeResponse validates the length and opcode of b, and returns it as ReadByGroupTypeResponse.
+// It returns ble.ErrInvalidPDU if b is shorter than 2 bytes, or the opcode isn't 0x11.
+func NewReadByGroupTypeResponse(b []byte) (ReadByGroupTypeResponse, error) {
+	if len(b) < 2 || b[0] != 0x11 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ReadByGroupTypeResponse(b), nil
+}
+
 // WriteRequestCode ...
 const WriteRequestCode = 0x12
 
 // WriteRequest implements Write Request (0x12) [Vol 3, Part E, 3.4.5.1].
 type WriteRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r WriteRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x12.
 func (r WriteRequest) SetAttributeOpcode() { r[0] = 0x12 }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r WriteRequest) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r WriteRequest) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// AttributeValue ...
+// AttributeValue returns the Attribute Value field.
 func (r WriteRequest) AttributeValue() []byte { return r[3:] }
 
-// SetAttributeValue ...
+// SetAttributeValue sets the Attribute Value field.
 func (r WriteRequest) SetAttributeValue(v []byte) { copy(r[3:], v) }
 
+// NewWriteRequest validates the length and opcode of b, and returns it as WriteRequest.
+// It returns ble.ErrInvalidPDU if b is shorter than 3 bytes, or the opcode isn't 0x12.
+func NewWriteRequest(b []byte) (WriteRequest, error) {
+	if len(b) < 3 || b[0] != 0x12 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return WriteRequest(b), nil
+}
+
 // WriteResponseCode ...
 const WriteResponseCode = 0x13
 
 // WriteResponse implements Write Response (0x13) [Vol 3, Part E, 3.4.5.2].
 type WriteResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r WriteResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x13.
 func (r WriteResponse) SetAttributeOpcode() { r[0] = 0x13 }
 
+// NewWriteResponse validates the length and opcode of b, and returns it as WriteResponse.
+// It returns ble.ErrInvalidPDU if b isn't 1 bytes long, or the opcode isn't 0x13.
+func NewWriteResponse(b []byte) (WriteResponse, error) {
+	if len(b) != 1 || b[0] != 0x13 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return WriteResponse(b), nil
+}
+
 // WriteCommandCode ...
 const WriteCommandCode = 0x52
 
 // WriteCommand implements Write Command (0x52) [Vol 3, Part E, 3.4.5.3].
 type WriteCommand []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r WriteCommand) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x52.
 func (r WriteCommand) SetAttributeOpcode() { r[0] = 0x52 }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r WriteCommand) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r WriteCommand) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// AttributeValue ...
+// AttributeValue returns the Attribute Value field.
 func (r WriteCommand) AttributeValue() []byte { return r[3:] }
 
-// SetAttributeValue ...
+// SetAttributeValue sets the Attribute Value field.
 func (r WriteCommand) SetAttributeValue(v []byte) { copy(r[3:], v) }
 
+// NewWriteCommand validates the length and opcode of b, and returns it as WriteCommand.
+// It returns ble.ErrInvalidPDU if b is shorter than 3 bytes, or the opcode isn't 0x52.
+func NewWriteCommand(b []byte) (WriteCommand, error) {
+	if len(b) < 3 || b[0] != 0x52 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return WriteCommand(b), nil
+}
+
 // SignedWriteCommandCode ...
 const SignedWriteCommandCode = 0xD2
 
 // SignedWriteCommand implements Signed Write Command (0xD2) [Vol 3, Part E, 3.4.5.4].
 type SignedWriteCommand []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r SignedWriteCommand) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0xD2.
 func (r SignedWriteCommand) SetAttributeOpcode() { r[0] = 0xD2 }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r SignedWriteCommand) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r SignedWriteCommand) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// AttributeValue ...
+// AttributeValue returns the Attribute Value field.
 func (r SignedWriteCommand) AttributeValue() []byte { return r[3:] }
 
-// SetAttributeValue ...
+// SetAttributeValue sets the Attribute Value field.
 func (r SignedWriteCommand) SetAttributeValue(v []byte) { copy(r[3:], v) }
 
-// AuthenticationSignature ...
+// AuthenticationSignature returns the Authentication Signature field.
 func (r SignedWriteCommand) AuthenticationSignature() [12]byte {
 	b := [12]byte{}
 	copy(b[:], r[3:])
 	return b
 }
 
-// SetAuthenticationSignature ...
+// SetAuthenticationSignature sets the Authentication Signature field.
 func (r SignedWriteCommand) SetAuthenticationSignature(v [12]byte) { copy(r[3:3+12], v[:]) }
 
+// NewSignedWriteCommand validates the length and opcode of b, and returns it as SignedWriteCommand.
+// It returns ble.ErrInvalidPDU if b is shorter than 15 bytes, or the opcode isn't 0xD2.
+func NewSignedWriteCommand(b []byte) (SignedWriteCommand, error) {
+	if len(b) < 15 || b[0] != 0xD2 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return SignedWriteCommand(b), nil
+}
+
 // PrepareWriteRequestCode ...
 const PrepareWriteRequestCode = 0x16
 
 // PrepareWriteRequest implements Prepare Write Request (0x16) [Vol 3, Part E, 3.4.6.1].
 type PrepareWriteRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r PrepareWriteRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x16.
 func (r PrepareWriteRequest) SetAttributeOpcode() { r[0] = 0x16 }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r PrepareWriteRequest) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r PrepareWriteRequest) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// ValueOffset ...
+// ValueOffset returns the Value Offset field.
 func (r PrepareWriteRequest) ValueOffset() uint16 { return binary.LittleEndian.Uint16(r[3:]) }
 
-// SetValueOffset ...
+// SetValueOffset sets the Value Offset field.
 func (r PrepareWriteRequest) SetValueOffset(v uint16) { binary.LittleEndian.PutUint16(r[3:], v) }
 
-// PartAttributeValue ...
+// PartAttributeValue returns the Part Attribute Value field.
 func (r PrepareWriteRequest) PartAttributeValue() []byte { return r[5:] }
 
-// SetPartAttributeValue ...
+// SetPartAttributeValue sets the Part Attribute Value field.
 func (r PrepareWriteRequest) SetPartAttributeValue(v []byte) { copy(r[5:], v) }
 
+// NewPrepareWriteRequest validates the length and opcode of b, and returns it as PrepareWriteRequest.
+// It returns ble.ErrInvalidPDU if b is shorter than 5 bytes, or the opcode isn't 0x16.
+func NewPrepareWriteRequest(b []byte) (PrepareWriteRequest, error) {
+	if len(b) < 5 || b[0] != 0x16 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return PrepareWriteRequest(b), nil
+}
+
 // PrepareWriteResponseCode ...
 const PrepareWriteResponseCode = 0x17
 
 // PrepareWriteResponse implements Prepare Write Response (0x17) [Vol 3, Part E, 3.4.6.2].
 type PrepareWriteResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r PrepareWriteResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x17.
 func (r PrepareWriteResponse) SetAttributeOpcode() { r[0] = 0x17 }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r PrepareWriteResponse) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r PrepareWriteResponse) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// ValueOffset ...
+// ValueOffset returns the Value Offset field.
 func (r PrepareWriteResponse) ValueOffset() uint16 { return binary.LittleEndian.Uint16(r[3:]) }
 
-// SetValueOffset ...
+// SetValueOffset sets the Value Offset field.
 func (r PrepareWriteResponse) SetValueOffset(v uint16) { binary.LittleEndian.PutUint16(r[3:], v) }
 
-// PartAttributeValue ...
+// PartAttributeValue returns the Part Attribute Value field.
 func (r PrepareWriteResponse) PartAttributeValue() []byte { return r[5:] }
 
-// SetPartAttributeValue ...
+// SetPartAttributeValue sets the Part Attribute Value field.
 func (r PrepareWriteResponse) SetPartAttributeValue(v []byte) { copy(r[5:], v) }
 
+// NewPrepareWriteResponse validates the length and opcode of b, and returns it as PrepareWriteResponse.
+// It returns ble.ErrInvalidPDU if b is shorter than 5 bytes, or the opcode isn't 0x17.
+func NewPrepareWriteResponse(b []byte) (PrepareWriteResponse, error) {
+	if len(b) < 5 || b[0] != 0x17 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return PrepareWriteResponse(b), nil
+}
+
 // ExecuteWriteRequestCode ...
 const ExecuteWriteRequestCode = 0x18
 
 // ExecuteWriteRequest implements Execute Write Request (0x18) [Vol 3, Part E, 3.4.6.3].
 type ExecuteWriteRequest []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ExecuteWriteRequest) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x18.
 func (r ExecuteWriteRequest) SetAttributeOpcode() { r[0] = 0x18 }
 
-// Flags ...
+// Flags returns the Flags field.
 func (r ExecuteWriteRequest) Flags() uint8 { return r[1] }
 
-// SetFlags ...
+// SetFlags sets the Flags field.
 func (r ExecuteWriteRequest) SetFlags(v uint8) { r[1] = v }
 
+// NewExecuteWriteRequest validates the length and opcode of b, and returns it as ExecuteWriteRequest.
+// It returns ble.ErrInvalidPDU if b isn't 2 bytes long, or the opcode isn't 0x18.
+func NewExecuteWriteRequest(b []byte) (ExecuteWriteRequest, error) {
+	if len(b) != 2 || b[0] != 0x18 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ExecuteWriteRequest(b), nil
+}
+
 // ExecuteWriteResponseCode ...
 const ExecuteWriteResponseCode = 0x19
 
 // ExecuteWriteResponse implements Execute Write Response (0x19) [Vol 3, Part E, 3.4.6.4].
 type ExecuteWriteResponse []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r ExecuteWriteResponse) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x19.
 func (r ExecuteWriteResponse) SetAttributeOpcode() { r[0] = 0x19 }
 
+// NewExecuteWriteResponse validates the length and opcode of b, and returns it as ExecuteWriteResponse.
+// It returns ble.ErrInvalidPDU if b isn't 1 bytes long, or the opcode isn't 0x19.
+func NewExecuteWriteResponse(b []byte) (ExecuteWriteResponse, error) {
+	if len(b) != 1 || b[0] != 0x19 {
+		return nil, ble.ErrInvalidPDU
+	}
+	return ExecuteWriteResponse(b), nil
+}
+
 // HandleValueNotificationCode ...
 const HandleValueNotificationCode = 0x1B
 
 // HandleValueNotification implements Handle Value Notification (0x1B) [Vol 3, Part E, 3.4.7.1].
 type HandleValueNotification []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r HandleValueNotification) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x1B.
 func (r HandleValueNotification) SetAttributeOpcode() { r[0] = 0x1B }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r HandleValueNotification) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r HandleValueNotification) SetAttributeHandle(v uint16) {
 	binary.LittleEndian.PutUint16(r[1:], v)
 }
 
-// AttributeValue ...
+// AttributeValue returns the Attribute Value field.
 func (r HandleValueNotification) AttributeValue() []byte { return r[3:] }
 
-// SetAttributeValue ...
+// SetAttributeValue sets the Attribute Value field.
 func (r HandleValueNotification) SetAttributeValue(v []byte) { copy(r[3:], v) }
 
+// NewHandleValueNotification validates the length and opcode of b, and returns it as HandleValueNotification.
+// It returns ble.ErrInvalidPDU if b is shorter than 3 bytes, or the opcode isn't 0x1B.
+func NewHandleValueNotification(b []byte) (HandleValueNotification, error) {
+	if len(b) < 3 || b[0] != 0x1B {
+		return nil, ble.ErrInvalidPDU
+	}
+	return HandleValueNotification(b), nil
+}
+
 // HandleValueIndicationCode ...
 const HandleValueIndicationCode = 0x1D
 
 // HandleValueIndication implements Handle Value Indication (0x1D) [Vol 3, Part E, 3.4.7.2].
 type HandleValueIndication []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r HandleValueIndication) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x1D.
 func (r HandleValueIndication) SetAttributeOpcode() { r[0] = 0x1D }
 
-// AttributeHandle ...
+// AttributeHandle returns the Attribute Handle field.
 func (r HandleValueIndication) AttributeHandle() uint16 { return binary.LittleEndian.Uint16(r[1:]) }
 
-// SetAttributeHandle ...
+// SetAttributeHandle sets the Attribute Handle field.
 func (r HandleValueIndication) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
-// AttributeValue ...
+// AttributeValue returns the Attribute Value field.
 func (r HandleValueIndication) AttributeValue() []byte { return r[3:] }
 
-// SetAttributeValue ...
+// SetAttributeValue sets the Attribute Value field.
 func (r HandleValueIndication) SetAttributeValue(v []byte) { copy(r[3:], v) }
 
+// NewHandleValueIndication validates the length and opcode of b, and returns it as HandleValueIndication.
+// It returns ble.ErrInvalidPDU if b is shorter than 3 bytes, or the opcode isn't 0x1D.
+func NewHandleValueIndication(b []byte) (HandleValueIndication, error) {
+	if len(b) < 3 || b[0] != 0x1D {
+		return nil, ble.ErrInvalidPDU
+	}
+	return HandleValueIndication(b), nil
+}
+
 // HandleValueConfirmationCode ...
 const HandleValueConfirmationCode = 0x1E
 
 // HandleValueConfirmation implements Handle Value Confirmation (0x1E) [Vol 3, Part E, 3.4.7.3].
 type HandleValueConfirmation []byte
 
-// AttributeOpcode ...
+// AttributeOpcode returns the Attribute Opcode field.
 func (r HandleValueConfirmation) AttributeOpcode() uint8 { return r[0] }
 
-// SetAttributeOpcode ...
+// SetAttributeOpcode sets the Attribute Opcode field to 0x1E.
 func (r HandleValueConfirmation) SetAttributeOpcode() { r[0] = 0x1E }
+
+// NewHandleValueConfirmation validates the length and opcode of b, and returns it as HandleValueConfirmation.
+// It returns ble.ErrInvalidPDU if b isn't 1 bytes long, or the opcode isn't 0x1E.
+func NewHandleValueConfirmation(b []byte) (HandleValueConfirmation, error) {
+	if len(b) != 1 || b[0] != 0x1E {
+		return nil, ble.ErrInvalidPDU
+	}
+	return HandleValueConfirmation(b), nil
+}
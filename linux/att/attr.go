@@ -11,4 +11,16 @@ type attr struct {
 	v  []byte
 	rh ble.ReadHandler
 	wh ble.WriteHandler
+
+	// hidden attributes are omitted from discovery responses.
+	hidden bool
+
+	// writeOnly attributes are responded with ErrReadNotPerm to reads,
+	// without invoking any handler or returning the static value.
+	writeOnly bool
+}
+
+// writeOnly reports whether the properties allow writes, but not reads.
+func writeOnly(p ble.Property) bool {
+	return p&ble.CharRead == 0 && p&(ble.CharWrite|ble.CharWriteNR) != 0
 }
@@ -0,0 +1,230 @@
+package atttest
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/currantlabs/ble"
+	"github.com/currantlabs/ble/linux/att"
+)
+
+// DiscoveredDB is the structure of the attributes discovered by Discover.
+type DiscoveredDB struct {
+	Services []Service
+}
+
+// A Service is a primary service discovered.
+type Service struct {
+	Handle          uint16
+	EndHandle       uint16
+	UUID            ble.UUID
+	Characteristics []Characteristic
+}
+
+// A Characteristic is a characteristic discovered.
+type Characteristic struct {
+	Handle      uint16 // Handle of the declaration.
+	ValueHandle uint16
+	Property    ble.Property
+	UUID        ble.UUID
+	Descriptors []Descriptor
+}
+
+// A Descriptor is a characteristic descriptor discovered.
+type Descriptor struct {
+	Handle uint16
+	UUID   ble.UUID
+}
+
+// Discover runs the discovery procedures of a central against s, and returns
+// the structure discovered. The MTU is exchanged, the primary services are
+// discovered by Read By Group Type Requests, and each of them is looked up by
+// a Find By Type Value Request. The characteristics are then discovered by
+// Read By Type Requests, and the descriptors by Find Information Requests.
+// [Vol 3, Part G, 4.3 - 4.7]
+//
+// The requests are processed with ProcessRequest, so Discover must not be
+// called while s is looping.
+func Discover(s *att.Server) (DiscoveredDB, error) {
+	var db DiscoveredDB
+
+	mtu := att.ExchangeMTURequest(make([]byte, 3))
+	mtu.SetAttributeOpcode()
+	mtu.SetClientRxMTU(ble.MaxMTU)
+	if _, err := request(s, mtu, att.ExchangeMTUResponseCode); err != nil {
+		return db, fmt.Errorf("exchange MTU: %s", err)
+	}
+
+	svcs, err := discoverServices(s)
+	if err != nil {
+		return db, fmt.Errorf("discover services: %s", err)
+	}
+	for i := range svcs {
+		svc := &svcs[i]
+		if err := findService(s, svc); err != nil {
+			return db, fmt.Errorf("find service %s: %s", svc.UUID, err)
+		}
+		if svc.Characteristics, err = discoverCharacteristics(s, svc); err != nil {
+			return db, fmt.Errorf("discover characteristics of %s: %s", svc.UUID, err)
+		}
+		for j := range svc.Characteristics {
+			c := &svc.Characteristics[j]
+			end := svc.EndHandle
+			if j+1 < len(svc.Characteristics) {
+				end = svc.Characteristics[j+1].Handle - 1
+			}
+			if c.Descriptors, err = discoverDescriptors(s, c.ValueHandle+1, end); err != nil {
+				return db, fmt.Errorf("discover descriptors of %s: %s", c.UUID, err)
+			}
+		}
+	}
+	db.Services = svcs
+	return db, nil
+}
+
+// discoverServices discovers all the primary services. [Vol 3, Part G, 4.4.1]
+func discoverServices(s *att.Server) ([]Service, error) {
+	var svcs []Service
+	for start := uint16(0x0001); ; {
+		req := att.ReadByGroupTypeRequest(make([]byte, 7))
+		req.SetAttributeOpcode()
+		req.SetStartingHandle(start)
+		req.SetEndingHandle(0xFFFF)
+		req.SetAttributeGroupType(ble.PrimaryServiceUUID)
+		b, err := request(s, req, att.ReadByGroupTypeResponseCode)
+		if err == ble.ErrAttrNotFound {
+			return svcs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rsp := att.ReadByGroupTypeResponse(b)
+		n, list := int(rsp.Length()), rsp.AttributeDataList()
+		if n != 6 && n != 20 || len(list)%n != 0 {
+			return nil, att.ErrInvalidResponse
+		}
+		for ; len(list) != 0; list = list[n:] {
+			svcs = append(svcs, Service{
+				Handle:    binary.LittleEndian.Uint16(list),
+				EndHandle: binary.LittleEndian.Uint16(list[2:]),
+				UUID:      ble.UUID(append([]byte{}, list[4:n]...)),
+			})
+		}
+		end := svcs[len(svcs)-1].EndHandle
+		if end == 0xFFFF {
+			return svcs, nil
+		}
+		start = end + 1
+	}
+}
+
+// findService looks up svc by its UUID. [Vol 3, Part G, 4.4.2]
+func findService(s *att.Server, svc *Service) error {
+	req := att.FindByTypeValueRequest(make([]byte, 7+svc.UUID.Len()))
+	req.SetAttributeOpcode()
+	req.SetStartingHandle(svc.Handle)
+	req.SetEndingHandle(0xFFFF)
+	req.SetAttributeType(binary.LittleEndian.Uint16(ble.PrimaryServiceUUID))
+	req.SetAttributeValue(svc.UUID)
+	b, err := request(s, req, att.FindByTypeValueResponseCode)
+	if err != nil {
+		return err
+	}
+	list := att.FindByTypeValueResponse(b).HandleInformationList()
+	if len(list) < 4 || binary.LittleEndian.Uint16(list) != svc.Handle || binary.LittleEndian.Uint16(list[2:]) != svc.EndHandle {
+		return fmt.Errorf("found % X, want 0x%04X-0x%04X", list, svc.Handle, svc.EndHandle)
+	}
+	return nil
+}
+
+// discoverCharacteristics discovers all the characteristics of svc.
+// [Vol 3, Part G, 4.6.1]
+func discoverCharacteristics(s *att.Server, svc *Service) ([]Characteristic, error) {
+	var cc []Characteristic
+	for start := svc.Handle; start <= svc.EndHandle; {
+		req := att.ReadByTypeRequest(make([]byte, 7))
+		req.SetAttributeOpcode()
+		req.SetStartingHandle(start)
+		req.SetEndingHandle(svc.EndHandle)
+		req.SetAttributeType(ble.CharacteristicUUID)
+		b, err := request(s, req, att.ReadByTypeResponseCode)
+		if err == ble.ErrAttrNotFound {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rsp := att.ReadByTypeResponse(b)
+		n, list := int(rsp.Length()), rsp.AttributeDataList()
+		if n < 2 || len(list)%n != 0 {
+			return nil, att.ErrInvalidResponse
+		}
+		for ; len(list) != 0; list = list[n:] {
+			prop, vh, u, ok := att.ParseCharacteristicDeclaration(list[2:n])
+			if !ok {
+				return nil, att.ErrInvalidResponse
+			}
+			cc = append(cc, Characteristic{
+				Handle:      binary.LittleEndian.Uint16(list),
+				ValueHandle: vh,
+				Property:    prop,
+				UUID:        ble.UUID(append([]byte{}, u...)),
+			})
+		}
+		last := cc[len(cc)-1].Handle
+		if last == 0xFFFF {
+			break
+		}
+		start = last + 1
+	}
+	return cc, nil
+}
+
+// discoverDescriptors discovers the descriptors in range [start, end].
+// [Vol 3, Part G, 4.7.1]
+func discoverDescriptors(s *att.Server, start, end uint16) ([]Descriptor, error) {
+	var dd []Descriptor
+	for start != 0 && start <= end {
+		req := att.FindInformationRequest(make([]byte, 5))
+		req.SetAttributeOpcode()
+		req.SetStartingHandle(start)
+		req.SetEndingHandle(end)
+		b, err := request(s, req, att.FindInformationResponseCode)
+		if err == ble.ErrAttrNotFound {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rsp := att.FindInformationResponse(b)
+		n := 4
+		if rsp.Format() == 0x02 {
+			n = 18
+		}
+		list := rsp.InformationData()
+		if len(list) == 0 || len(list)%n != 0 {
+			return nil, att.ErrInvalidResponse
+		}
+		for ; len(list) != 0; list = list[n:] {
+			dd = append(dd, Descriptor{
+				Handle: binary.LittleEndian.Uint16(list),
+				UUID:   ble.UUID(append([]byte{}, list[2:n]...)),
+			})
+		}
+		start = dd[len(dd)-1].Handle + 1
+	}
+	return dd, nil
+}
+
+// request processes req with s, and returns the response of the opcode op.
+// An Error Response is returned as its error code.
+func request(s *att.Server, req []byte, op byte) ([]byte, error) {
+	rsp := s.ProcessRequest(req)
+	if _, _, e, ok := att.ParseErrorResponse(rsp); ok {
+		return nil, e
+	}
+	if len(rsp) == 0 || rsp[0] != op {
+		return nil, att.ErrInvalidResponse
+	}
+	return rsp, nil
+}
@@ -0,0 +1,139 @@
+package atttest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/currantlabs/ble"
+	"github.com/currantlabs/ble/linux/att"
+	"golang.org/x/net/context"
+)
+
+// testConn is a ble.Conn for a Server, which is only driven by ProcessRequest.
+type testConn struct {
+	ble.Conn
+	txMTU int
+}
+
+func (c *testConn) Context() context.Context      { return context.Background() }
+func (c *testConn) RemoteAddr() ble.Addr          { return ble.NewAddr("AA:BB:CC:DD:EE:FF") }
+func (c *testConn) RxMTU() int                    { return ble.MaxMTU }
+func (c *testConn) TxMTU() int                    { return c.txMTU }
+func (c *testConn) SetTxMTU(mtu int)              { c.txMTU = mtu }
+func (c *testConn) Disconnected() <-chan struct{} { return nil }
+
+func newServer(t *testing.T, db *att.DB) *att.Server {
+	s, err := att.NewServer(db, &testConn{txMTU: ble.DefaultMTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDiscover(t *testing.T) {
+	svcUUID := ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7")
+	charUUID := ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE8")
+	svc := ble.NewService(svcUUID)
+	svc.NewCharacteristic(charUUID).SetValue([]byte("value"))
+	c := svc.NewCharacteristic(ble.UUID16(0x2A00))
+	c.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {}))
+	c.NewDescriptor(ble.UUID16(0x2901)).SetValue([]byte("name"))
+	battery := ble.NewService(ble.BatteryUUID)
+	level := battery.NewCharacteristic(ble.UUID16(0x2A19))
+	level.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) { rsp.Write([]byte{50}) }))
+	level.HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {}))
+
+	got, err := Discover(newServer(t, att.NewDB([]*ble.Service{svc, battery}, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DiscoveredDB{Services: []Service{
+		{Handle: 0x0001, EndHandle: 0x0006, UUID: svcUUID, Characteristics: []Characteristic{
+			{Handle: 0x0002, ValueHandle: 0x0003, Property: ble.CharRead, UUID: charUUID},
+			{
+				Handle:      0x0004,
+				ValueHandle: 0x0005,
+				Property:    ble.CharWrite | ble.CharWriteNR,
+				UUID:        ble.UUID16(0x2A00),
+				Descriptors: []Descriptor{{Handle: 0x0006, UUID: ble.UUID16(0x2901)}},
+			},
+		}},
+		{Handle: 0x0007, EndHandle: 0xFFFF, UUID: ble.BatteryUUID, Characteristics: []Characteristic{{
+			Handle:      0x0008,
+			ValueHandle: 0x0009,
+			Property:    ble.CharRead | ble.CharNotify,
+			UUID:        ble.UUID16(0x2A19),
+			Descriptors: []Descriptor{{Handle: 0x000A, UUID: ble.ClientCharacteristicConfigUUID}},
+		}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discovered\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestMergeDBsDiscover(t *testing.T) {
+	battery := ble.NewService(ble.BatteryUUID)
+	level := battery.NewCharacteristic(ble.BatteryLevelUUID)
+	level.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) { rsp.Write([]byte{50}) }))
+	level.HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {}))
+	info := ble.NewService(ble.DeviceInfoUUID)
+	info.NewCharacteristic(ble.UUID16(0x2A29)).SetValue([]byte("Currant"))
+
+	db1, err := att.BuildDB([]*ble.Service{battery}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db2, err := att.BuildDB([]*ble.Service{info}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := att.MergeDBs(db1, db2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Discover(newServer(t, db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DiscoveredDB{Services: []Service{
+		{Handle: 0x0001, EndHandle: 0x0004, UUID: ble.BatteryUUID, Characteristics: []Characteristic{{
+			Handle:      0x0002,
+			ValueHandle: 0x0003,
+			Property:    ble.CharRead | ble.CharNotify,
+			UUID:        ble.BatteryLevelUUID,
+			Descriptors: []Descriptor{{Handle: 0x0004, UUID: ble.ClientCharacteristicConfigUUID}},
+		}}},
+		{Handle: 0x0005, EndHandle: 0xFFFF, UUID: ble.DeviceInfoUUID, Characteristics: []Characteristic{{
+			Handle:      0x0006,
+			ValueHandle: 0x0007,
+			Property:    ble.CharRead,
+			UUID:        ble.UUID16(0x2A29),
+		}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discovered\n%+v\nwant\n%+v", got, want)
+	}
+	if level.ValueHandle != 0x0003 || info.Characteristics[0].ValueHandle != 0x0007 {
+		t.Errorf("value handles 0x%04X, 0x%04X, want 0x0003, 0x0007", level.ValueHandle, info.Characteristics[0].ValueHandle)
+	}
+}
+
+func TestMergeDBsWithoutServices(t *testing.T) {
+	db1, err := att.BuildDB([]*ble.Service{ble.NewService(ble.BatteryUUID)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(db1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db2 att.DB
+	if err := json.Unmarshal(b, &db2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := att.MergeDBs(db1, &db2); err == nil {
+		t.Error("merged a DB without services")
+	}
+}
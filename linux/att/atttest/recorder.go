@@ -0,0 +1,101 @@
+// Package atttest provides utilities for testing the ATT server and the
+// handlers that are served by it.
+package atttest
+
+import (
+	"sync"
+
+	"github.com/currantlabs/ble"
+)
+
+// An Invocation is a request that has been served by a Recorder.
+type Invocation struct {
+	Conn   ble.Conn
+	Write  bool   // true if the request was served by ServeWrite.
+	Offset int    // Offset of the request, if any.
+	Data   []byte // A copy of the data carried by the request, if any.
+}
+
+// A Response is a scripted response to be returned by a Recorder.
+type Response struct {
+	Value  []byte       // Value to be written to the ResponseWriter.
+	Status ble.ATTError // Status to be set on the ResponseWriter.
+}
+
+// Recorder is a ble.ReadHandler and ble.WriteHandler that records every
+// request it serves, and responds with the scripted Responses in order.
+// Once the script is exhausted, the Recorder responds with ble.ErrSuccess,
+// and no value.
+type Recorder struct {
+	sync.Mutex
+	script []Response
+	calls  []Invocation
+}
+
+// NewRecorder returns a Recorder, which responds with rsps in order.
+func NewRecorder(rsps ...Response) *Recorder {
+	return &Recorder{script: rsps}
+}
+
+// ServeRead records the request, and writes the next scripted Response.
+func (r *Recorder) ServeRead(req ble.Request, rsp ble.ResponseWriter) {
+	r.serve(false, req, rsp)
+}
+
+// ServeWrite records the request, and writes the next scripted Response.
+func (r *Recorder) ServeWrite(req ble.Request, rsp ble.ResponseWriter) {
+	r.serve(true, req, rsp)
+}
+
+func (r *Recorder) serve(write bool, req ble.Request, rsp ble.ResponseWriter) {
+	r.Lock()
+	defer r.Unlock()
+	var data []byte
+	if req.Data() != nil {
+		data = append([]byte{}, req.Data()...)
+	}
+	r.calls = append(r.calls, Invocation{
+		Conn:   req.Conn(),
+		Write:  write,
+		Offset: req.Offset(),
+		Data:   data,
+	})
+	if len(r.script) == 0 {
+		return
+	}
+	s := r.script[0]
+	r.script = r.script[1:]
+	if s.Value != nil {
+		rsp.Write(s.Value)
+	}
+	rsp.SetStatus(s.Status)
+}
+
+// Script appends rsps to the Responses to be returned.
+func (r *Recorder) Script(rsps ...Response) {
+	r.Lock()
+	defer r.Unlock()
+	r.script = append(r.script, rsps...)
+}
+
+// Invocations returns a copy of the requests that have been served, in order.
+func (r *Recorder) Invocations() []Invocation {
+	r.Lock()
+	defer r.Unlock()
+	return append([]Invocation{}, r.calls...)
+}
+
+// Len returns the number of requests that have been served.
+func (r *Recorder) Len() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.calls)
+}
+
+// Reset discards the recorded requests and the remaining scripted Responses.
+func (r *Recorder) Reset() {
+	r.Lock()
+	defer r.Unlock()
+	r.calls = nil
+	r.script = nil
+}
@@ -0,0 +1,59 @@
+package atttest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestRecorder(t *testing.T) {
+	conn := &testConn{txMTU: ble.DefaultMTU}
+	r := NewRecorder(
+		Response{Value: []byte{0x01, 0x02}},
+		Response{Status: ble.ErrWriteNotPerm},
+	)
+
+	serve := func(write bool, data []byte, offset int) ([]byte, ble.ATTError) {
+		buf := bytes.NewBuffer(make([]byte, 0, ble.DefaultMTU))
+		rsp := ble.NewResponseWriter(buf)
+		req := ble.NewRequest(conn, data, offset)
+		if write {
+			r.ServeWrite(req, rsp)
+		} else {
+			r.ServeRead(req, rsp)
+		}
+		return buf.Bytes(), rsp.Status()
+	}
+
+	if b, status := serve(false, nil, 0); !bytes.Equal(b, []byte{0x01, 0x02}) || status != ble.ErrSuccess {
+		t.Errorf("read: value [% X] status %v, want [01 02] %v", b, status, ble.ErrSuccess)
+	}
+	data := []byte{0x03}
+	if b, status := serve(true, data, 4); len(b) != 0 || status != ble.ErrWriteNotPerm {
+		t.Errorf("write: value [% X] status %v, want [] %v", b, status, ble.ErrWriteNotPerm)
+	}
+	data[0] = 0xFF
+	if b, status := serve(false, nil, 2); len(b) != 0 || status != ble.ErrSuccess {
+		t.Errorf("exhausted: value [% X] status %v, want [] %v", b, status, ble.ErrSuccess)
+	}
+
+	want := []Invocation{
+		{Conn: conn},
+		{Conn: conn, Write: true, Offset: 4, Data: []byte{0x03}},
+		{Conn: conn, Offset: 2},
+	}
+	if got := r.Invocations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("invocations %+v, want %+v", got, want)
+	}
+
+	r.Script(Response{Status: ble.ErrAuthentication})
+	r.Reset()
+	if r.Len() != 0 {
+		t.Errorf("%d invocations after Reset, want 0", r.Len())
+	}
+	if _, status := serve(true, nil, 0); status != ble.ErrSuccess {
+		t.Errorf("status %v after Reset, want %v", status, ble.ErrSuccess)
+	}
+}
@@ -0,0 +1,84 @@
+package att
+
+import (
+	"sync"
+
+	"github.com/currantlabs/ble"
+)
+
+// A CCCDStore persists the Client Characteristic Configuration of bonded
+// peers across connections. [Vol 3, Part G, 3.3.3.3]
+//
+// The handle is the handle of the Client Characteristic Configuration
+// descriptor. It's up to the implementation to decide which peers are bonded;
+// it can simply ignore the others.
+type CCCDStore interface {
+	// Load returns the configuration stored for the peer, or 0 if none.
+	Load(addr ble.Addr, handle uint16) (uint16, error)
+
+	// Save stores the configuration for the peer.
+	Save(addr ble.Addr, handle uint16, value uint16) error
+}
+
+// NewCCCDStore returns a CCCDStore, which keeps the configurations in memory.
+func NewCCCDStore() CCCDStore {
+	return &memCCCDStore{m: make(map[string]map[uint16]uint16)}
+}
+
+type memCCCDStore struct {
+	sync.Mutex
+	m map[string]map[uint16]uint16
+}
+
+func (s *memCCCDStore) Load(addr ble.Addr, handle uint16) (uint16, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.m[addr.String()][handle], nil
+}
+
+func (s *memCCCDStore) Save(addr ble.Addr, handle uint16, value uint16) error {
+	s.Lock()
+	defer s.Unlock()
+	cccs, ok := s.m[addr.String()]
+	if !ok {
+		cccs = make(map[uint16]uint16)
+		s.m[addr.String()] = cccs
+	}
+	cccs[handle] = value
+	return nil
+}
+
+// servers are the Servers looping, across which the subscriptions are counted.
+var servers = struct {
+	sync.Mutex
+	m map[*Server]struct{}
+}{m: make(map[*Server]struct{})}
+
+func register(s *Server) {
+	servers.Lock()
+	defer servers.Unlock()
+	servers.m[s] = struct{}{}
+}
+
+func deregister(s *Server) {
+	servers.Lock()
+	defer servers.Unlock()
+	delete(servers.m, s)
+}
+
+// SubscriberCount returns the number of connections, across all the Servers
+// looping, whose client has enabled the notifications or indications of the
+// characteristic value vh. It allows, e.g., a sensor to sample only while
+// anyone is subscribed. A Server is counted from the time its Loop starts,
+// till the time it returns.
+func SubscriberCount(vh uint16) int {
+	servers.Lock()
+	defer servers.Unlock()
+	n := 0
+	for s := range servers.m {
+		if s.cccOf(vh)&(cccNotify|cccIndicate) != 0 {
+			n++
+		}
+	}
+	return n
+}
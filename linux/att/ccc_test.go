@@ -0,0 +1,78 @@
+package att
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestInvalidCCCDWrite(t *testing.T) {
+	// The Appearance of testServices supports notifications, but not
+	// indications, and its CCCD is at 0x0006.
+	const h = 0x0006
+	_, c := newTestServer(t, testServices())
+	read := func() []byte { return c.request(t, pdu(ReadRequestCode, uint16(h))) }
+
+	for _, tc := range []struct {
+		name string
+		old  []byte
+		v    []byte
+		err  ble.ATTError
+	}{
+		{"short", []byte{0x00, 0x00}, []byte{0x01}, ble.ErrInvalAttrValueLen},
+		{"long", []byte{0x00, 0x00}, []byte{0x01, 0x00, 0x00}, ble.ErrInvalAttrValueLen},
+		{"empty", []byte{0x00, 0x00}, nil, ble.ErrInvalAttrValueLen},
+		{"reserved bit", []byte{0x00, 0x00}, []byte{0x04, 0x00}, ble.ErrWriteNotPerm},
+		{"reserved octet", []byte{0x00, 0x00}, []byte{0x01, 0x80}, ble.ErrWriteNotPerm},
+		{"indicate unsupported", []byte{0x00, 0x00}, []byte{0x02, 0x00}, ble.ErrWriteNotPerm},
+		{"both while notifying", []byte{0x01, 0x00}, []byte{0x03, 0x00}, ble.ErrWriteNotPerm},
+	} {
+		if b := c.request(t, pdu(WriteRequestCode, uint16(h), tc.old)); !bytes.Equal(b, []byte{WriteResponseCode}) {
+			t.Fatalf("%s: can't set up the CCCD: [% X]", tc.name, b)
+		}
+		if b, want := c.request(t, pdu(WriteRequestCode, uint16(h), tc.v)), newErrorResponse(WriteRequestCode, h, tc.err); !bytes.Equal(b, want) {
+			t.Errorf("%s: got [% X], want [% X]", tc.name, b, want)
+		}
+		// The subscriptions are left as they were.
+		if b, want := read(), pdu(ReadResponseCode, tc.old); !bytes.Equal(b, want) {
+			t.Errorf("%s: CCCD reads [% X], want [% X]", tc.name, b, want)
+		}
+	}
+}
+
+func TestRestoreCCCDs(t *testing.T) {
+	// The Appearance of testServices supports notifications, and its CCCD
+	// is at 0x0006.
+	const h = 0x0006
+	started := make(chan struct{}, 2)
+	ss := testServices()
+	ss[0].Characteristics[1].HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {
+		started <- struct{}{}
+		<-n.Context().Done()
+	}))
+	st := NewCCCDStore()
+	db := NewDB(ss, 1)
+	waitStarted := func() {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("the notify handler hasn't been started")
+		}
+	}
+
+	_, c1 := newTestServerDB(t, db, OptCCCDStore(st))
+	if b := c1.request(t, pdu(WriteRequestCode, uint16(h), uint16(cccNotify))); !bytes.Equal(b, []byte{WriteResponseCode}) {
+		t.Fatalf("write CCCD: [% X]", b)
+	}
+	waitStarted()
+	c1.Close()
+
+	// The peer reconnects, and is subscribed without writing the CCCD.
+	_, c2 := newTestServerDB(t, db, OptCCCDStore(st))
+	waitStarted()
+	if b, want := c2.request(t, pdu(ReadRequestCode, uint16(h))), pdu(ReadResponseCode, uint16(cccNotify)); !bytes.Equal(b, want) {
+		t.Errorf("CCCD reads [% X], want [% X]", b, want)
+	}
+}
@@ -0,0 +1,211 @@
+package att
+
+import (
+	"sync"
+	"time"
+
+	"github.com/currantlabs/ble"
+)
+
+// DeviceNameCharacteristic returns a Device Name characteristic, whose value
+// is returned by name at the time it's read. The name can be longer than
+// what fits in a single Read Response, in which case the remote central
+// reads the rest of it with Read Blob Requests.
+func DeviceNameCharacteristic(name func() string) *ble.Characteristic {
+	c := ble.NewCharacteristic(ble.DeviceNameUUID)
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		serveLongValue(req, rsp, []byte(name()))
+	}))
+	return c
+}
+
+// BatteryService returns a Battery Service, whose Battery Level characteristic
+// serves the percentage returned by level at the time it's read. If notify is
+// true, the characteristic supports notifications along with its CCCD, and
+// the level is notified once the remote central subscribes. The changes that
+// follow are sent with NotifyByUUID of ble.BatteryLevelUUID.
+// [BAS 1.0, 3.1]
+func BatteryService(level func() uint8, notify bool) *ble.Service {
+	s := ble.NewService(ble.BatteryUUID)
+	c := s.NewCharacteristic(ble.BatteryLevelUUID)
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		serveLongValue(req, rsp, []byte{level()})
+	}))
+	if notify {
+		c.HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {
+			n.Write([]byte{level()})
+			<-n.Context().Done()
+		}))
+	}
+	return s
+}
+
+// UserDescriptionDescriptor returns a Characteristic User Description
+// descriptor, whose value is text. Descriptions longer than what fits in a
+// single Read Response are read with Read Blob Requests. If writable is true,
+// the text is replaced by the values written; the characteristic should then
+// have the Writable Auxiliaries bit set in its Extended Properties.
+// [Vol 3, Part G, 3.3.3.2]
+func UserDescriptionDescriptor(text string, writable bool) *ble.Descriptor {
+	d := ble.NewDescriptor(ble.UserDescriptionUUID)
+	if !writable {
+		d.SetValue([]byte(text))
+		return d
+	}
+	var mu sync.Mutex
+	v := []byte(text)
+	d.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		mu.Lock()
+		defer mu.Unlock()
+		serveLongValue(req, rsp, v)
+	}))
+	d.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		mu.Lock()
+		defer mu.Unlock()
+		v = append([]byte{}, req.Data()...)
+	}))
+	return d
+}
+
+// A Feature is a bit of the Client Supported Features. [Vol 3, Part G, 7.2]
+type Feature byte
+
+// Features of the client.
+const (
+	FeatureRobustCaching         Feature = 0x01 // Robust Caching
+	FeatureEATT                  Feature = 0x02 // Enhanced ATT bearer
+	FeatureMultipleNotifications Feature = 0x04 // Multiple Handle Value Notifications
+)
+
+// ClientSupportedFeaturesCharacteristic returns a Client Supported Features
+// characteristic, which records the features written by each client. Once
+// a feature has been enabled, it can't be disabled by the client; writes
+// clearing a bit, or setting any bit beyond the first octet, which are all
+// reserved, are responded with ErrValueNotAllowed.
+// Servers report the features with ClientSupports. [Vol 3, Part G, 7.2]
+func ClientSupportedFeaturesCharacteristic() *ble.Characteristic {
+	c := ble.NewCharacteristic(ble.ClientSupportedFeaturesUUID)
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		cn, ok := req.Conn().(*conn)
+		if !ok {
+			rsp.SetStatus(ble.ErrUnlikely)
+			return
+		}
+		cn.mu.Lock()
+		defer cn.mu.Unlock()
+		serveLongValue(req, rsp, []byte{cn.features})
+	}))
+	c.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		v := req.Data()
+		if len(v) == 0 {
+			rsp.SetStatus(ble.ErrInvalAttrValueLen)
+			return
+		}
+		for _, b := range v[1:] {
+			if b != 0 {
+				rsp.SetStatus(ble.ErrValueNotAllowed)
+				return
+			}
+		}
+		cn, ok := req.Conn().(*conn)
+		if !ok {
+			rsp.SetStatus(ble.ErrUnlikely)
+			return
+		}
+		cn.mu.Lock()
+		defer cn.mu.Unlock()
+		if cn.features&^v[0] != 0 {
+			rsp.SetStatus(ble.ErrValueNotAllowed)
+			return
+		}
+		cn.features = v[0]
+	}))
+	return c
+}
+
+// A ServerFeature is a bit of the Server Supported Features. [Vol 3, Part G, 7.4]
+type ServerFeature byte
+
+// Features of the server.
+const (
+	ServerFeatureEATT ServerFeature = 0x01 // Enhanced ATT bearer
+)
+
+// ServerSupportedFeaturesCharacteristic returns a Server Supported Features
+// characteristic, whose value is the SupportedFeatures of the Server serving
+// it at the time it's read. [Vol 3, Part G, 7.4]
+func ServerSupportedFeaturesCharacteristic() *ble.Characteristic {
+	c := ble.NewCharacteristic(ble.ServerSupportedFeaturesUUID)
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		var f ServerFeature
+		if cn, ok := req.Conn().(*conn); ok {
+			f = cn.svr.SupportedFeatures()
+		}
+		serveLongValue(req, rsp, []byte{byte(f)})
+	}))
+	return c
+}
+
+// DatabaseHashCharacteristic returns a Database Hash characteristic, whose
+// value is the Hash of the DB served at the time it's read. [Vol 3, Part G, 7.3]
+//
+// The hash is computed while the Server holds the DB for the request, so
+// a read racing with SetDB returns the hash of either the old or the new
+// DB, whichever the read is handled against, and never a mix of both.
+func DatabaseHashCharacteristic() *ble.Characteristic {
+	c := ble.NewCharacteristic(ble.DatabaseHashUUID)
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		cn, ok := req.Conn().(*conn)
+		if !ok || cn.svr.db == nil {
+			rsp.SetStatus(ble.ErrUnlikely)
+			return
+		}
+		h := cn.svr.db.Hash()
+		serveLongValue(req, rsp, h[:])
+	}))
+	return c
+}
+
+// CachedValue returns a ReadHandler, which serves the value returned by
+// compute, and reuses it for the reads within ttl since it's computed,
+// including the Read Blob Requests reading the rest of it. It's meant for
+// values that are expensive to compute, but stable for a short while.
+// A nil value returned by compute is served as an empty value.
+// The time is provided by the Clock of the Server, if set.
+func CachedValue(ttl time.Duration, compute func() []byte) ble.ReadHandler {
+	var mu sync.Mutex
+	var v []byte
+	var expiry time.Time
+	return ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		now := time.Now()
+		if cn, ok := req.Conn().(*conn); ok {
+			now = cn.svr.now()
+		}
+		mu.Lock()
+		if v == nil || !now.Before(expiry) {
+			v, expiry = compute(), now.Add(ttl)
+			if v == nil {
+				v = []byte{}
+			}
+		}
+		cached := v
+		mu.Unlock()
+		serveLongValue(req, rsp, cached)
+	})
+}
+
+// serveLongValue writes the part of v starting at the offset of req, and
+// as much of it as the rsp can hold. It's meant to be used in read handlers
+// to support both Read and Read Blob Requests. [Vol 3, Part F, 3.4.4.5]
+func serveLongValue(req ble.Request, rsp ble.ResponseWriter, v []byte) {
+	off := req.Offset()
+	if off > len(v) {
+		rsp.SetStatus(ble.ErrInvalidOffset)
+		return
+	}
+	v = v[off:]
+	if n := rsp.Cap() - rsp.Len(); len(v) > n {
+		v = v[:n]
+	}
+	rsp.Write(v)
+}
@@ -0,0 +1,313 @@
+package att
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestClientSupportedFeatures(t *testing.T) {
+	svc := ble.NewService(ble.GATTUUID)
+	svc.AddCharacteristic(ClientSupportedFeaturesCharacteristic())
+	s, c := newTestServer(t, []*ble.Service{svc})
+
+	const h = 0x0003
+	write := func(v ...byte) []byte {
+		return c.request(t, pdu(WriteRequestCode, uint16(h), v))
+	}
+	read := func() []byte {
+		return c.request(t, pdu(ReadRequestCode, uint16(h)))
+	}
+	ok := []byte{WriteResponseCode}
+
+	if b := read(); !bytes.Equal(b, []byte{ReadResponseCode, 0x00}) {
+		t.Fatalf("read: got [% X]", b)
+	}
+	if b := write(byte(FeatureRobustCaching)); !bytes.Equal(b, ok) {
+		t.Fatalf("enable robust caching: got [% X]", b)
+	}
+	if b := read(); !bytes.Equal(b, []byte{ReadResponseCode, 0x01}) {
+		t.Fatalf("read: got [% X]", b)
+	}
+	if !s.ClientSupports(FeatureRobustCaching) || s.ClientSupports(FeatureEATT) {
+		t.Fatal("ClientSupports doesn't report the enabled features")
+	}
+	if b := write(byte(FeatureRobustCaching | FeatureEATT)); !bytes.Equal(b, ok) {
+		t.Fatalf("enable EATT: got [% X]", b)
+	}
+	if !s.ClientSupports(FeatureEATT) {
+		t.Fatal("ClientSupports doesn't report EATT")
+	}
+
+	for _, tc := range []struct {
+		name string
+		v    []byte
+		err  ble.ATTError
+	}{
+		{"clear a bit", []byte{byte(FeatureEATT)}, ble.ErrValueNotAllowed},
+		{"reserved octet", []byte{0x03, 0x01}, ble.ErrValueNotAllowed},
+		{"empty", nil, ble.ErrInvalAttrValueLen},
+	} {
+		if b := write(tc.v...); !bytes.Equal(b, newErrorResponse(WriteRequestCode, h, tc.err)) {
+			t.Errorf("%s: got [% X], want error %v", tc.name, b, tc.err)
+		}
+	}
+	if b := read(); !bytes.Equal(b, []byte{ReadResponseCode, 0x03}) {
+		t.Fatalf("rejected writes changed the features: [% X]", b)
+	}
+	if b := write(0x03, 0x00); !bytes.Equal(b, ok) {
+		t.Fatalf("zero reserved octet: got [% X]", b)
+	}
+}
+
+func TestReadBlobOffset(t *testing.T) {
+	withChar := func(c *ble.Characteristic) []*ble.Service {
+		s := ble.NewService(ble.GAPUUID)
+		s.AddCharacteristic(c)
+		return []*ble.Service{s}
+	}
+	withDesc := func(d *ble.Descriptor) []*ble.Service {
+		c := ble.NewCharacteristic(ble.DeviceNameUUID)
+		c.SetValue([]byte("Gopher"))
+		c.AddDescriptor(d)
+		return withChar(c)
+	}
+	static := ble.NewCharacteristic(ble.DeviceNameUUID)
+	static.SetValue([]byte("static"))
+	cached := ble.NewCharacteristic(ble.DeviceNameUUID)
+	cached.HandleRead(CachedValue(time.Minute, func() []byte { return []byte("cached") }))
+
+	for _, tc := range []struct {
+		name string
+		ss   []*ble.Service
+		h    uint16
+		v    []byte
+	}{
+		{"static", withChar(static), 0x0003, []byte("static")},
+		{"DeviceName", withChar(DeviceNameCharacteristic(func() string { return "Gopher" })), 0x0003, []byte("Gopher")},
+		{"CachedValue", withChar(cached), 0x0003, []byte("cached")},
+		{"UserDescription", withDesc(UserDescriptionDescriptor("fixed", false)), 0x0004, []byte("fixed")},
+		{"writable UserDescription", withDesc(UserDescriptionDescriptor("writable", true)), 0x0004, []byte("writable")},
+		{"BatteryLevel", []*ble.Service{BatteryService(func() uint8 { return 42 }, false)}, 0x0003, []byte{42}},
+		{"ClientSupportedFeatures", withChar(ClientSupportedFeaturesCharacteristic()), 0x0003, []byte{0x00}},
+		{"ServerSupportedFeatures", withChar(ServerSupportedFeaturesCharacteristic()), 0x0003, []byte{0x00}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, c := newTestServer(t, tc.ss)
+			blob := func(off int) []byte {
+				return c.request(t, pdu(ReadBlobRequestCode, tc.h, uint16(off)))
+			}
+			if b, want := blob(1), pdu(ReadBlobResponseCode, tc.v[1:]); !bytes.Equal(b, want) {
+				t.Errorf("offset 1: got [% X], want [% X]", b, want)
+			}
+			if b, want := blob(len(tc.v)), pdu(ReadBlobResponseCode); !bytes.Equal(b, want) {
+				t.Errorf("offset == len: got [% X], want [% X]", b, want)
+			}
+			if b, want := blob(len(tc.v)+1), newErrorResponse(ReadBlobRequestCode, tc.h, ble.ErrInvalidOffset); !bytes.Equal(b, want) {
+				t.Errorf("offset > len: got [% X], want [% X]", b, want)
+			}
+		})
+	}
+}
+
+func TestServerSupportedFeatures(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		eatt bool
+	}{
+		{"default", nil, false},
+		{"EATT", []Option{OptSupportedFeatures(ServerFeatureEATT)}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := ble.NewService(ble.GATTUUID)
+			svc.AddCharacteristic(ServerSupportedFeaturesCharacteristic())
+			_, c := newTestServer(t, []*ble.Service{svc}, tc.opts...)
+
+			// Read it by type, as a client not knowing the handle does.
+			req := pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.ServerSupportedFeaturesUUID)
+			b := c.request(t, req)
+			if len(b) != 5 || b[0] != ReadByTypeResponseCode || b[1] != 3 {
+				t.Fatalf("got [% X]", b)
+			}
+			f := ServerFeature(b[4])
+			if eatt := f&ServerFeatureEATT != 0; eatt != tc.eatt {
+				t.Errorf("EATT %t, want %t", eatt, tc.eatt)
+			}
+			if r := f &^ ServerFeatureEATT; r != 0 {
+				t.Errorf("reserved bits 0x%02X set", byte(r))
+			}
+		})
+	}
+}
+
+func TestCachedValue(t *testing.T) {
+	var computed byte
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(CachedValue(time.Second, func() []byte {
+		computed++
+		return bytes.Repeat([]byte{computed}, 30)
+	}))
+	clk := newFakeClock()
+	_, c := newTestServer(t, []*ble.Service{svc}, OptClock(clk))
+
+	const h = 0x0003
+	read := func() []byte { return c.request(t, pdu(ReadRequestCode, uint16(h))) }
+	blob := func(off int) []byte { return c.request(t, pdu(ReadBlobRequestCode, uint16(h), uint16(off))) }
+
+	if b, want := read(), pdu(ReadResponseCode, bytes.Repeat([]byte{1}, 22)); !bytes.Equal(b, want) {
+		t.Fatalf("read: got [% X], want [% X]", b, want)
+	}
+	// The rest of the value is read from the cache within the TTL.
+	clk.Advance(999 * time.Millisecond)
+	if b, want := blob(22), pdu(ReadBlobResponseCode, bytes.Repeat([]byte{1}, 8)); !bytes.Equal(b, want) {
+		t.Errorf("blob within the TTL: got [% X], want [% X]", b, want)
+	}
+	if computed != 1 {
+		t.Errorf("computed %d times within the TTL, want 1", computed)
+	}
+	// And recomputed once it has expired.
+	clk.Advance(time.Millisecond)
+	if b, want := blob(22), pdu(ReadBlobResponseCode, bytes.Repeat([]byte{2}, 8)); !bytes.Equal(b, want) {
+		t.Errorf("blob after the TTL: got [% X], want [% X]", b, want)
+	}
+	if b, want := read(), pdu(ReadResponseCode, bytes.Repeat([]byte{2}, 22)); !bytes.Equal(b, want) {
+		t.Errorf("read after the TTL: got [% X], want [% X]", b, want)
+	}
+	if computed != 2 {
+		t.Errorf("computed %d times, want 2", computed)
+	}
+}
+
+func TestUserDescriptionDescriptor(t *testing.T) {
+	const long = "The temperature of the room, measured every minute, in degrees Celsius"
+	for _, writable := range []bool{false, true} {
+		c := ble.NewCharacteristic(ble.UUID16(0xFFF1))
+		c.SetValue([]byte{0x01})
+		c.AddDescriptor(UserDescriptionDescriptor(long, writable))
+		svc := ble.NewService(ble.UUID16(0xFFF0))
+		svc.AddCharacteristic(c)
+		_, conn := newTestServer(t, []*ble.Service{svc})
+
+		// The description is read in blobs, as long as they fill the responses.
+		const h = 0x0004
+		b := conn.request(t, pdu(ReadRequestCode, uint16(h)))
+		got := append([]byte{}, b[1:]...)
+		for len(b) == ble.DefaultMTU {
+			b = conn.request(t, pdu(ReadBlobRequestCode, uint16(h), uint16(len(got))))
+			if b[0] != ReadBlobResponseCode {
+				t.Fatalf("writable %t: blob at %d: got [% X]", writable, len(got), b)
+			}
+			got = append(got, b[1:]...)
+		}
+		if string(got) != long {
+			t.Errorf("writable %t: read %q, want %q", writable, got, long)
+		}
+
+		b = conn.request(t, pdu(WriteRequestCode, uint16(h), "Temperature"))
+		if !writable {
+			if want := newErrorResponse(WriteRequestCode, h, ble.ErrWriteNotPerm); !bytes.Equal(b, want) {
+				t.Errorf("write: got [% X], want [% X]", b, want)
+			}
+			continue
+		}
+		if !bytes.Equal(b, []byte{WriteResponseCode}) {
+			t.Fatalf("write: got [% X]", b)
+		}
+		if b, want := conn.request(t, pdu(ReadRequestCode, uint16(h))), pdu(ReadResponseCode, "Temperature"); !bytes.Equal(b, want) {
+			t.Errorf("read after the write: got [% X], want [% X]", b, want)
+		}
+	}
+}
+
+// TestDatabaseHashSetDB reads the Database Hash while the DB is replaced, and
+// is meant to be run with -race. Each hash read is the one of either DB.
+func TestDatabaseHashSetDB(t *testing.T) {
+	newDB := func(extra bool) *DB {
+		gatt := ble.NewService(ble.GATTUUID)
+		gatt.AddCharacteristic(DatabaseHashCharacteristic())
+		ss := append([]*ble.Service{gatt}, testServices()...)
+		if extra {
+			ss = append(ss, ble.NewService(ble.BatteryUUID))
+		}
+		return NewDB(ss, 1)
+	}
+	a, b := newDB(false), newDB(true)
+	ha, hb := a.Hash(), b.Hash()
+	if ha == hb {
+		t.Fatal("both DBs hash to the same value")
+	}
+	s, c := newTestServerDB(t, a)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if i%2 == 0 {
+				s.SetDB(b)
+			} else {
+				s.SetDB(a)
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		v := c.request(t, pdu(ReadRequestCode, uint16(0x0003)))
+		if !bytes.Equal(v, pdu(ReadResponseCode, ha[:])) && !bytes.Equal(v, pdu(ReadResponseCode, hb[:])) {
+			t.Fatalf("read [% X], want the hash [% X] or [% X]", v, ha, hb)
+		}
+	}
+}
+
+func TestBatteryService(t *testing.T) {
+	// Battery Service at 0x0001, Battery Level declaration at 0x0002, its
+	// value at 0x0003, and CCCD, if notifying, at 0x0004.
+	level := uint8(42)
+	s, c := newTestServer(t, []*ble.Service{BatteryService(func() uint8 { return level }, true)})
+	read := func() []byte { return c.request(t, pdu(ReadRequestCode, uint16(0x0003))) }
+
+	if b, want := read(), pdu(ReadResponseCode, 42); !bytes.Equal(b, want) {
+		t.Errorf("read: got [% X], want [% X]", b, want)
+	}
+	level = 41
+	if b, want := read(), pdu(ReadResponseCode, 41); !bytes.Equal(b, want) {
+		t.Errorf("read: got [% X], want [% X]", b, want)
+	}
+	want := pdu(ReadByTypeResponseCode, 7, uint16(0x0002), byte(ble.CharRead|ble.CharNotify), uint16(0x0003), ble.BatteryLevelUUID)
+	if b := c.request(t, pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.CharacteristicUUID)); !bytes.Equal(b, want) {
+		t.Errorf("declaration: got [% X], want [% X]", b, want)
+	}
+
+	// The level is notified once subscribed, and on changes.
+	if b := c.request(t, pdu(WriteRequestCode, uint16(0x0004), uint16(cccNotify))); !bytes.Equal(b, []byte{WriteResponseCode}) {
+		t.Fatalf("subscribe: got [% X]", b)
+	}
+	if b, want := c.recv(t), pdu(HandleValueNotificationCode, uint16(0x0003), 41); !bytes.Equal(b, want) {
+		t.Errorf("subscribed: got [% X], want [% X]", b, want)
+	}
+	if _, err := s.NotifyByUUID(false, ble.BatteryLevelUUID, []byte{40}); err != nil {
+		t.Fatal(err)
+	}
+	if b, want := c.recv(t), pdu(HandleValueNotificationCode, uint16(0x0003), 40); !bytes.Equal(b, want) {
+		t.Errorf("changed: got [% X], want [% X]", b, want)
+	}
+
+	// Without notifications, the level is read only, and has no CCCD.
+	s, c = newTestServer(t, []*ble.Service{BatteryService(func() uint8 { return 100 }, false)})
+	if b, want := c.request(t, pdu(FindInformationRequestCode, uint16(0x0001), uint16(0xFFFF))),
+		pdu(FindInformationResponseCode, 0x01,
+			uint16(0x0001), ble.PrimaryServiceUUID,
+			uint16(0x0002), ble.CharacteristicUUID,
+			uint16(0x0003), ble.BatteryLevelUUID); !bytes.Equal(b, want) {
+		t.Errorf("read only: got [% X], want [% X]", b, want)
+	}
+	if _, err := s.NotifyByUUID(false, ble.BatteryLevelUUID, []byte{40}); err != ble.ErrInvalidHandle {
+		t.Errorf("read only: notified with %v, want ErrInvalidHandle", err)
+	}
+}
@@ -0,0 +1,36 @@
+package att
+
+// Chunk splits data into slices that each fit in a single Handle Value
+// Notification or Indication for the given ATT_MTU. The 3 bytes of ATT header
+// (opcode + attribute handle) are accounted for, so each chunk is at most
+// mtu-3 bytes long. [Vol 3, Part F, 3.4.7.1]
+//
+// The returned slices share the underlying array of data.
+// Chunk returns nil if data is empty, or mtu can't hold any payload.
+func Chunk(data []byte, mtu int) [][]byte {
+	n := MaxNotifyPayload(mtu)
+	if len(data) == 0 || n == 0 {
+		return nil
+	}
+	chunks := make([][]byte, 0, (len(data)+n-1)/n)
+	for len(data) > n {
+		chunks = append(chunks, data[:n:n])
+		data = data[n:]
+	}
+	return append(chunks, data)
+}
+
+// Reassemble concatenates chunks, as returned by Chunk, back into a single value.
+// It's meant to be used on the client side, where the chunks are collected from
+// successive notifications or indications of the same attribute.
+func Reassemble(chunks [][]byte) []byte {
+	n := 0
+	for _, c := range chunks {
+		n += len(c)
+	}
+	b := make([]byte, 0, n)
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	return b
+}
@@ -15,6 +15,12 @@ type NotificationHandler interface {
 }
 
 // Client implementa an Attribute Protocol Client.
+//
+// A client can have only one request outstanding at a time; it must not send
+// another request until the response of the previous one has been received.
+// [Vol 3, Part F, 3.3.2] The Client enforces it by queueing the requests issued
+// concurrently, until the one in progress completes, or by failing them with
+// ErrTransactionInProgress, if it's set non-blocking.
 type Client struct {
 	l2c  ble.Conn
 	rspc chan []byte
@@ -23,6 +29,18 @@ type Client struct {
 	chTxBuf chan []byte
 	chErr   chan error
 	handler NotificationHandler
+
+	chNotif    chan Notification
+	blockNotif bool
+
+	nonBlocking bool
+}
+
+// A Notification is a Handle Value Notification or Indication received.
+type Notification struct {
+	Handle     uint16
+	Value      []byte
+	Indication bool
 }
 
 // NewClient returns an Attribute Protocol Client.
@@ -49,7 +67,10 @@ func (c *Client) ExchangeMTU(clientRxMTU int) (serverRxMTU int, err error) {
 	// Acquire and reuse the txBuf, and release it after usage.
 	// The same txBuf, or a newly allocate one, if the txMTU is changed,
 	// will be released back to the channel.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return 0, err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	// Let L2CAP know the MTU we can handle.
@@ -98,7 +119,10 @@ func (c *Client) FindInformation(starth, endh uint16) (fmt int, data []byte, err
 	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return 0, nil, err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := FindInformationRequest(txBuf[:5])
@@ -152,7 +176,10 @@ func (c *Client) ReadByType(starth, endh uint16, uuid ble.UUID) (int, []byte, er
 	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return 0, nil, err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := ReadByTypeRequest(txBuf[:5+len(uuid)])
@@ -186,7 +213,10 @@ func (c *Client) ReadByType(starth, endh uint16, uuid ble.UUID) (int, []byte, er
 func (c *Client) Read(handle uint16) ([]byte, error) {
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := ReadRequest(txBuf[:3])
@@ -219,7 +249,10 @@ func (c *Client) Read(handle uint16) ([]byte, error) {
 func (c *Client) ReadBlob(handle, offset uint16) ([]byte, error) {
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := ReadBlobRequest(txBuf[:5])
@@ -260,7 +293,10 @@ func (c *Client) ReadMultiple(handles []uint16) ([]byte, error) {
 	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := ReadMultipleRequest(txBuf[:1+len(handles)*2])
@@ -300,7 +336,10 @@ func (c *Client) ReadByGroupType(starth, endh uint16, uuid ble.UUID) (int, []byt
 	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return 0, nil, err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := ReadByGroupTypeRequest(txBuf[:5+len(uuid)])
@@ -340,7 +379,10 @@ func (c *Client) Write(handle uint16, value []byte) error {
 	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := WriteRequest(txBuf[:3+len(value)])
@@ -374,7 +416,10 @@ func (c *Client) WriteCommand(handle uint16, value []byte) error {
 	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := WriteCommand(txBuf[:3+len(value)])
@@ -393,7 +438,10 @@ func (c *Client) SignedWrite(handle uint16, value []byte, signature [12]byte) er
 	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := SignedWriteCommand(txBuf[:15+len(value)])
@@ -415,7 +463,10 @@ func (c *Client) PrepareWrite(handle uint16, offset uint16, value []byte) (uint1
 	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return 0, 0, nil, err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := PrepareWriteRequest(txBuf[:5+len(value)])
@@ -449,7 +500,10 @@ func (c *Client) PrepareWrite(handle uint16, offset uint16, value []byte) (uint1
 func (c *Client) ExecuteWrite(flags uint8) error {
 
 	// Acquire and reuse the txBuf, and release it after usage.
-	txBuf := <-c.chTxBuf
+	txBuf, err := c.acquire()
+	if err != nil {
+		return err
+	}
 	defer func() { c.chTxBuf <- txBuf }()
 
 	req := ExecuteWriteRequest(txBuf[:1])
@@ -474,6 +528,27 @@ func (c *Client) ExecuteWrite(flags uint8) error {
 	return nil
 }
 
+// SetNonBlocking sets whether the requests issued while another one is in
+// progress fail with ErrTransactionInProgress, instead of being queued until
+// it completes. The commands, which share the buffer of the requests, are
+// handled likewise. SetNonBlocking must be called before issuing any request.
+func (c *Client) SetNonBlocking(nonBlocking bool) {
+	c.nonBlocking = nonBlocking
+}
+
+// acquire acquires the txBuf for a request, which serializes the requests.
+func (c *Client) acquire() ([]byte, error) {
+	if !c.nonBlocking {
+		return <-c.chTxBuf, nil
+	}
+	select {
+	case b := <-c.chTxBuf:
+		return b, nil
+	default:
+		return nil, ErrTransactionInProgress
+	}
+}
+
 func (c *Client) sendCmd(b []byte) error {
 	_, err := c.l2c.Write(b)
 	return err
@@ -508,6 +583,49 @@ func (c *Client) sendReq(b []byte) (rsp []byte, err error) {
 	}
 }
 
+// Notifications returns a channel, which delivers the notifications and
+// indications received, in addition to the NotificationHandler, if any.
+// Indications are confirmed by the Client automatically.
+//
+// The channel buffers up to size notifications. When it's full, the oldest
+// one is dropped, unless block is true, in which case the Client stops
+// receiving until the consumer catches up. This also holds up the responses
+// of the pending requests, and the confirmations of the indications, which
+// are sent after the indications are delivered. So a blocking consumer must
+// not send requests from the goroutine consuming the channel.
+// The channel is closed when the Loop returns.
+// Notifications must be called before the Loop starts.
+func (c *Client) Notifications(size int, block bool) <-chan Notification {
+	c.chNotif = make(chan Notification, size)
+	c.blockNotif = block
+	return c.chNotif
+}
+
+// deliver sends n to the channel returned by Notifications.
+func (c *Client) deliver(n Notification) {
+	if c.blockNotif {
+		c.chNotif <- n
+		return
+	}
+	for {
+		select {
+		case c.chNotif <- n:
+			return
+		default:
+		}
+		// Drop the oldest one to make room for n, or n itself if unbuffered.
+		if cap(c.chNotif) == 0 {
+			logger.Error("client", "req", "dropped a notification.")
+			return
+		}
+		select {
+		case <-c.chNotif:
+			logger.Error("client", "req", "dropped a notification.")
+		default:
+		}
+	}
+}
+
 // Loop ...
 func (c *Client) Loop() {
 
@@ -518,6 +636,9 @@ func (c *Client) Loop() {
 
 	ch := make(chan asyncWork, 16)
 	defer close(ch)
+	if c.chNotif != nil {
+		defer close(c.chNotif)
+	}
 	go func() {
 		for w := range ch {
 			w.handle(w.data)
@@ -544,11 +665,20 @@ func (c *Client) Loop() {
 		}
 
 		// Deliver the full request to upper layer.
-		select {
-		case ch <- asyncWork{handle: c.handler.HandleNotification, data: b}:
-		default:
-			// If this really happens, especially on a slow machine, enlarge the channel buffer.
-			logger.Error("client", "req", "can't enqueue incoming notification.")
+		if c.handler != nil {
+			select {
+			case ch <- asyncWork{handle: c.handler.HandleNotification, data: b}:
+			default:
+				// If this really happens, especially on a slow machine, enlarge the channel buffer.
+				logger.Error("client", "req", "can't enqueue incoming notification.")
+			}
+		}
+		if c.chNotif != nil && len(b) >= 3 {
+			c.deliver(Notification{
+				Handle:     binary.LittleEndian.Uint16(b[1:]),
+				Value:      b[3:],
+				Indication: b[0] == HandleValueIndicationCode,
+			})
 		}
 
 		// Always write aknowledgement for an indication, even it was an invalid request.
@@ -0,0 +1,204 @@
+package att
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/currantlabs/ble"
+)
+
+// newTestClient returns a Client over a testConn, whose in carries the PDUs
+// sent by the server, and out the ones sent by the Client. The connection is
+// closed, once the test completes.
+func newTestClient(t testing.TB, h NotificationHandler) (*Client, *testConn) {
+	t.Helper()
+	c := newTestConn(ble.MaxMTU)
+	t.Cleanup(func() { c.Close() })
+	return NewClient(c, h), c
+}
+
+func notifyPDU(h uint16, v byte) []byte {
+	return pdu(HandleValueNotificationCode, h, v)
+}
+
+func indicatePDU(h uint16, v byte) []byte {
+	return pdu(HandleValueIndicationCode, h, v)
+}
+
+// confirmed waits for the confirmation of an indication sent to the Client.
+func confirmed(t *testing.T, c *testConn) {
+	t.Helper()
+	if b := c.recv(t); !bytes.Equal(b, []byte{HandleValueConfirmationCode}) {
+		t.Fatalf("got [% X], want a confirmation", b)
+	}
+}
+
+// next returns the next notification delivered by ch.
+func next(t *testing.T, ch <-chan Notification) Notification {
+	t.Helper()
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("nothing has been delivered")
+	}
+	return Notification{}
+}
+
+// closed checks that ch is closed, and has nothing left to deliver.
+func closed(t *testing.T, ch <-chan Notification) {
+	t.Helper()
+	select {
+	case n, ok := <-ch:
+		if ok {
+			t.Fatalf("got %+v, want the channel closed", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the channel hasn't been closed")
+	}
+}
+
+type handlerFunc func(req []byte)
+
+func (f handlerFunc) HandleNotification(req []byte) { f(req) }
+
+func TestNotificationsDropOldest(t *testing.T) {
+	handled := make(chan []byte, 4)
+	cln, c := newTestClient(t, handlerFunc(func(req []byte) { handled <- req }))
+	ch := cln.Notifications(2, false)
+	go cln.Loop()
+
+	c.in <- notifyPDU(0x0001, 1)
+	c.in <- notifyPDU(0x0002, 2)
+	c.in <- notifyPDU(0x0003, 3)
+	c.in <- indicatePDU(0x0004, 4)
+	// The indication is confirmed, once all of them have been delivered.
+	confirmed(t, c)
+
+	if n, want := next(t, ch), (Notification{Handle: 0x0003, Value: []byte{3}}); !equalNotification(n, want) {
+		t.Errorf("got %+v, want %+v", n, want)
+	}
+	if n, want := next(t, ch), (Notification{Handle: 0x0004, Value: []byte{4}, Indication: true}); !equalNotification(n, want) {
+		t.Errorf("got %+v, want %+v", n, want)
+	}
+	// The NotificationHandler is served every one of them.
+	for _, want := range [][]byte{notifyPDU(0x0001, 1), notifyPDU(0x0002, 2), notifyPDU(0x0003, 3), indicatePDU(0x0004, 4)} {
+		select {
+		case b := <-handled:
+			if !bytes.Equal(b, want) {
+				t.Errorf("handled [% X], want [% X]", b, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("[% X] hasn't been handled", want)
+		}
+	}
+
+	c.Close()
+	closed(t, ch)
+}
+
+func TestNotificationsBlock(t *testing.T) {
+	cln, c := newTestClient(t, nil)
+	ch := cln.Notifications(1, true)
+	go cln.Loop()
+
+	c.in <- notifyPDU(0x0001, 1)
+	c.in <- notifyPDU(0x0002, 2)
+	c.in <- indicatePDU(0x0003, 3)
+
+	// The Client holds the rest back, until the first one is consumed.
+	select {
+	case b := <-c.out:
+		t.Fatalf("sent [% X] while blocked", b)
+	case <-time.After(50 * time.Millisecond):
+	}
+	for i, want := range []Notification{
+		{Handle: 0x0001, Value: []byte{1}},
+		{Handle: 0x0002, Value: []byte{2}},
+		{Handle: 0x0003, Value: []byte{3}, Indication: true},
+	} {
+		if n := next(t, ch); !equalNotification(n, want) {
+			t.Errorf("%d: got %+v, want %+v", i, n, want)
+		}
+	}
+	confirmed(t, c)
+
+	c.Close()
+	closed(t, ch)
+}
+
+func TestNotificationsUnbuffered(t *testing.T) {
+	cln, c := newTestClient(t, nil)
+	ch := cln.Notifications(0, false)
+	go cln.Loop()
+
+	// Nobody is receiving, so both are dropped, rather than blocking the
+	// Client.
+	c.in <- notifyPDU(0x0001, 1)
+	c.in <- indicatePDU(0x0002, 2)
+	confirmed(t, c)
+
+	c.Close()
+	closed(t, ch)
+}
+
+func equalNotification(a, b Notification) bool {
+	return a.Handle == b.Handle && a.Indication == b.Indication && bytes.Equal(a.Value, b.Value)
+}
+
+func TestClientTransactionInProgress(t *testing.T) {
+	for _, nonBlocking := range []bool{true, false} {
+		cln, c := newTestClient(t, nil)
+		cln.SetNonBlocking(nonBlocking)
+		go cln.Loop()
+
+		// The first request waits for its response.
+		done := make(chan error, 2)
+		go func() {
+			_, err := cln.Read(0x0003)
+			done <- err
+		}()
+		if b, want := c.recv(t), pdu(ReadRequestCode, uint16(0x0003)); !bytes.Equal(b, want) {
+			t.Fatalf("sent [% X], want [% X]", b, want)
+		}
+
+		if nonBlocking {
+			if _, err := cln.Read(0x0005); err != ErrTransactionInProgress {
+				t.Errorf("Read: got %v, want %v", err, ErrTransactionInProgress)
+			}
+			if err := cln.WriteCommand(0x0005, []byte{1}); err != ErrTransactionInProgress {
+				t.Errorf("WriteCommand: got %v, want %v", err, ErrTransactionInProgress)
+			}
+			if err := cln.SignedWrite(0x0005, []byte{1}, [12]byte{}); err != ErrTransactionInProgress {
+				t.Errorf("SignedWrite: got %v, want %v", err, ErrTransactionInProgress)
+			}
+			c.in <- pdu(ReadResponseCode, "Gopher")
+			if err := <-done; err != nil {
+				t.Errorf("first Read: %v", err)
+			}
+			continue
+		}
+
+		// The second request is queued, until the first one completes.
+		go func() {
+			_, err := cln.Read(0x0005)
+			done <- err
+		}()
+		select {
+		case b := <-c.out:
+			t.Fatalf("sent [% X] while a request is in progress", b)
+		case <-time.After(50 * time.Millisecond):
+		}
+		c.in <- pdu(ReadResponseCode, "Gopher")
+		if b, want := c.recv(t), pdu(ReadRequestCode, uint16(0x0005)); !bytes.Equal(b, want) {
+			t.Fatalf("sent [% X], want [% X]", b, want)
+		}
+		c.in <- pdu(ReadResponseCode, uint16(0x0201))
+		for i := 0; i < 2; i++ {
+			if err := <-done; err != nil {
+				t.Errorf("Read: %v", err)
+			}
+		}
+	}
+}
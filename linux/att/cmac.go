@@ -0,0 +1,60 @@
+package att
+
+import "crypto/aes"
+
+// aesCMAC returns the AES-CMAC of m with the 128-bit key k. [RFC 4493]
+func aesCMAC(k, m []byte) [16]byte {
+	c, err := aes.NewCipher(k)
+	if err != nil {
+		panic(err)
+	}
+
+	// Generate the subkeys k1 and k2 from the encrypted zero block.
+	var k1, k2 [16]byte
+	c.Encrypt(k1[:], k1[:])
+	shiftXor := func(dst, src *[16]byte) {
+		msb := src[0] >> 7
+		for i := 0; i < 15; i++ {
+			dst[i] = src[i]<<1 | src[i+1]>>7
+		}
+		dst[15] = src[15] << 1
+		if msb != 0 {
+			dst[15] ^= 0x87
+		}
+	}
+	shiftXor(&k1, &k1)
+	shiftXor(&k2, &k1)
+
+	// The last block is xored with k1 if it's complete, or padded and
+	// xored with k2 otherwise.
+	n := (len(m) + 15) / 16
+	var last [16]byte
+	if n != 0 && len(m)%16 == 0 {
+		copy(last[:], m[(n-1)*16:])
+		for i := range last {
+			last[i] ^= k1[i]
+		}
+	} else {
+		if n == 0 {
+			n = 1
+		}
+		r := copy(last[:], m[(n-1)*16:])
+		last[r] = 0x80
+		for i := range last {
+			last[i] ^= k2[i]
+		}
+	}
+
+	var x [16]byte
+	for b := 0; b < n-1; b++ {
+		for i := range x {
+			x[i] ^= m[b*16+i]
+		}
+		c.Encrypt(x[:], x[:])
+	}
+	for i := range x {
+		x[i] ^= last[i]
+	}
+	c.Encrypt(x[:], x[:])
+	return x
+}
@@ -0,0 +1,28 @@
+package att
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestAESCMAC(t *testing.T) {
+	// The examples of RFC 4493, 4.
+	k, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	m, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172a" +
+		"ae2d8a571e03ac9c9eb76fac45af8e51" +
+		"30c81c46a35ce411e5fbc1191a0a52ef" +
+		"f69f2445df4f9b17ad2b417be66c3710")
+	for _, tc := range []struct {
+		n   int
+		mac string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		if mac := aesCMAC(k, m[:tc.n]); hex.EncodeToString(mac[:]) != tc.mac {
+			t.Errorf("%d bytes: got %x, want %s", tc.n, mac, tc.mac)
+		}
+	}
+}
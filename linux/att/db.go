@@ -2,15 +2,30 @@ package att
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/currantlabs/ble"
 )
 
 // A DB is a contiguous range of attributes.
+//
+// By default, the attributes are kept in memory. A DB returned by NewStoreDB
+// reads them from a Store instead, e.g. a read-only table in flash.
 type DB struct {
 	attrs []*attr
 	base  uint16 // handle for first attr in attrs
+
+	// store, if set, provides the attributes in place of attrs.
+	store Store
+
+	// byType indexes attrs by their types, in ascending order of handles.
+	// Lookups fall back to scanning the attrs, if it's not built.
+	byType map[string][]*attr
+
+	// svcs are the services the attrs are generated from.
+	svcs []*ble.Service
 }
 
 const (
@@ -25,23 +40,36 @@ func (r *DB) idx(h int) int {
 	if h < int(r.base) {
 		return tooSmall
 	}
-	if int(h) >= int(r.base)+len(r.attrs) {
+	if int(h) >= int(r.base)+r.len() {
 		return tooLarge
 	}
 	return h - int(r.base)
 }
 
+// len returns the number of attributes.
+func (r *DB) len() int {
+	if r.store != nil {
+		return r.store.Len()
+	}
+	return len(r.attrs)
+}
+
 // at returns attr a.
 func (r *DB) at(h uint16) (a *attr, ok bool) {
 	i := r.idx(int(h))
 	if i < 0 {
 		return nil, false
 	}
+	if r.store != nil {
+		return r.store.Attribute(i).attr(), true
+	}
 	return r.attrs[i], true
 }
 
 // subrange returns attributes in range [start, end]; it may return an empty slice.
 // subrange does not panic for out-of-range start or end.
+// Since the handles of attrs are contiguous, the bounds are computed directly
+// from the handles without scanning, and the returned slice shares attrs.
 func (r *DB) subrange(start, end uint16) []*attr {
 	startidx := r.idx(int(start))
 	switch startidx {
@@ -56,43 +84,356 @@ func (r *DB) subrange(start, end uint16) []*attr {
 	case tooSmall:
 		return []*attr{}
 	case tooLarge:
-		endidx = len(r.attrs)
+		endidx = r.len()
+	}
+	if r.store != nil {
+		aa := make([]*attr, 0, endidx-startidx)
+		for i := startidx; i < endidx; i++ {
+			aa = append(aa, r.store.Attribute(i).attr())
+		}
+		return aa
 	}
 	return r.attrs[startidx:endidx]
 }
 
+// subrangeOfType returns attributes of type t in range [start, end]; it may return an empty slice.
+func (r *DB) subrangeOfType(t ble.UUID, start, end uint16) []*attr {
+	if r.byType == nil {
+		var aa []*attr
+		for _, a := range r.subrange(start, end) {
+			if a.typ.Equal(t) {
+				aa = append(aa, a)
+			}
+		}
+		return aa
+	}
+	aa := r.byType[string(t)]
+	i := sort.Search(len(aa), func(i int) bool { return aa[i].h >= start })
+	j := sort.Search(len(aa), func(i int) bool { return aa[i].h > end })
+	return aa[i:j]
+}
+
+// index builds the index of attributes by their types.
+func (r *DB) index() {
+	r.byType = make(map[string][]*attr)
+	for _, a := range r.attrs {
+		r.byType[string(a.typ)] = append(r.byType[string(a.typ)], a)
+	}
+}
+
 // NewDB ...
 func NewDB(ss []*ble.Service, base uint16) *DB {
 	h := base
 	var attrs []*attr
 	var aa []*attr
-	for i, s := range ss {
+	for _, s := range ss {
 		h, aa = genSvcAttr(s, h)
-		if i == len(ss)-1 {
-			aa[0].endh = 0xFFFF
-		}
 		attrs = append(attrs, aa...)
 	}
+	db := &DB{attrs: attrs, base: base, svcs: ss}
+
+	// The included services may follow the including ones, so the Include
+	// Declarations are filled once all the handles are assigned.
+	for _, s := range ss {
+		for i, in := range s.Includes {
+			a, _ := db.at(s.Handle + 1 + uint16(i))
+			a.v = IncludeDeclaration(in.Handle, in.EndHandle, in.UUID)
+		}
+	}
+	db.RecalculateGroupEnds()
 	DumpAttributes(attrs)
-	return &DB{attrs: attrs, base: base}
+	db.index()
+	return db
 }
 
+// BuildDB validates the services, including the consistency of the properties
+// of the characteristics with their handlers, and returns a DB of them, as
+// NewDB does. The handles are assigned sequentially from base, and the
+// declarations and Client Characteristic Configuration descriptors are
+// inserted as needed.
+func BuildDB(ss []*ble.Service, base uint16) (*DB, error) {
+	if base == 0 {
+		return nil, fmt.Errorf("invalid base handle 0x0000")
+	}
+	n := 0
+	for _, s := range ss {
+		if err := checkUUID(s.UUID); err != nil {
+			return nil, fmt.Errorf("service %s: %s", s.UUID, err)
+		}
+		n += 1 + len(s.Includes)
+		for _, in := range s.Includes {
+			if !containsService(ss, in) {
+				return nil, fmt.Errorf("service %s: included service %s not served", s.UUID, in.UUID)
+			}
+		}
+		for _, c := range s.Characteristics {
+			if err := checkUUID(c.UUID); err != nil {
+				return nil, fmt.Errorf("characteristic %s: %s", c.UUID, err)
+			}
+			if c.Value != nil && c.ReadHandler != nil {
+				return nil, fmt.Errorf("characteristic %s: both static value and read handler", c.UUID)
+			}
+			if err := checkProperty(c); err != nil {
+				return nil, fmt.Errorf("characteristic %s: %s", c.UUID, err)
+			}
+			n += 2 + len(c.Descriptors)
+			if c.CCCD == nil && (c.NotifyHandler != nil || c.IndicateHandler != nil) {
+				n++
+			}
+			for _, d := range c.Descriptors {
+				if err := checkUUID(d.UUID); err != nil {
+					return nil, fmt.Errorf("descriptor %s: %s", d.UUID, err)
+				}
+			}
+		}
+	}
+	if int(base)+n-1 > 0xFFFF {
+		return nil, fmt.Errorf("%d attributes don't fit in handles from 0x%04X", n, base)
+	}
+	return NewDB(ss, base), nil
+}
+
+// MergeDBs composes the services of dbs, in order, into a single DB, whose
+// handles are reassigned contiguously from the base of the first one. The
+// handles referenced by the declarations, and the ones kept by the
+// characteristics and descriptors are updated accordingly, so the dbs must
+// not be served anymore. A service can't be included in more than one of dbs.
+// The dbs must be built from services; a DB loaded by UnmarshalJSON can't be
+// merged, as its attributes can't be renumbered.
+func MergeDBs(dbs ...*DB) (*DB, error) {
+	if len(dbs) == 0 {
+		return nil, fmt.Errorf("no DB to merge")
+	}
+	seen := make(map[*ble.Service]bool)
+	var ss []*ble.Service
+	for i, db := range dbs {
+		if db.svcs == nil {
+			return nil, fmt.Errorf("DB %d: no services to merge", i)
+		}
+		for _, s := range db.svcs {
+			if seen[s] {
+				return nil, fmt.Errorf("service %s: included more than once", s.UUID)
+			}
+			seen[s] = true
+			ss = append(ss, s)
+		}
+	}
+	return BuildDB(ss, dbs[0].base)
+}
+
+// CharacteristicInfo describes a characteristic declared in a DB.
+type CharacteristicInfo struct {
+	Handle      uint16 // Handle of the declaration.
+	ValueHandle uint16
+	UUID        ble.UUID
+	Property    ble.Property
+}
+
+// CharacteristicsWithProperty returns the characteristics, whose properties
+// include all the bits of prop, in the order of handles. For example,
+// CharIndicate|CharNotify lists the ones supporting both notifications and
+// indications. Hidden characteristics are included.
+func (r *DB) CharacteristicsWithProperty(prop ble.Property) []CharacteristicInfo {
+	var cc []CharacteristicInfo
+	for _, a := range r.subrangeOfType(ble.CharacteristicUUID, 0x0001, 0xFFFF) {
+		p, vh, u, ok := ParseCharacteristicDeclaration(a.v)
+		if ok && p&prop == prop {
+			cc = append(cc, CharacteristicInfo{Handle: a.h, ValueHandle: vh, UUID: u, Property: p})
+		}
+	}
+	return cc
+}
+
+// Hash returns the Database Hash of r, the AES-CMAC with a zero key over the
+// handles, types and values of the declarations, and the handles and types
+// of the descriptors, in the order of handles. Values of the Characteristic
+// Extended Properties are included as well. Hidden attributes aren't covered,
+// as they aren't discovered by clients. [Vol 3, Part G, 7.3.1]
+//
+// The hash is returned in the byte order it's transmitted.
+func (r *DB) Hash() [16]byte {
+	var m []byte
+	for _, a := range r.subrange(0x0001, 0xFFFF) {
+		if a.hidden || a.typ.Len() != 2 {
+			continue
+		}
+		t := binary.LittleEndian.Uint16(a.typ)
+		switch {
+		case t >= 0x2800 && t <= 0x2803, t == 0x2900:
+			m = append(m, byte(a.h), byte(a.h>>8), byte(t), byte(t>>8))
+			m = append(m, a.v...)
+		case t >= 0x2901 && t <= 0x2905:
+			m = append(m, byte(a.h), byte(a.h>>8), byte(t), byte(t>>8))
+		}
+	}
+	var h [16]byte
+	t := aesCMAC(make([]byte, 16), m)
+	for i := range t {
+		h[i] = t[15-i]
+	}
+	return h
+}
+
+// attrJSON is the JSON form of an attr.
+type attrJSON struct {
+	Handle    uint16 `json:"handle"`
+	EndHandle uint16 `json:"end_handle,omitempty"`
+	Type      string `json:"type"`
+	Value     []byte `json:"value"`
+	Dynamic   bool   `json:"dynamic,omitempty"`  // has a ReadHandler
+	Writable  bool   `json:"writable,omitempty"` // has a WriteHandler
+	Hidden    bool   `json:"hidden,omitempty"`
+	WriteOnly bool   `json:"write_only,omitempty"`
+}
+
+// MarshalJSON returns the layout of the attributes, i.e. the handles, types,
+// static values, and permissions, in JSON. The attributes served by handlers
+// are marked dynamic or writable, as the handlers can't be serialized.
+// It's meant for tooling, which inspects or diffs the layouts.
+func (r *DB) MarshalJSON() ([]byte, error) {
+	all := r.subrange(0x0001, 0xFFFF)
+	aa := make([]attrJSON, 0, len(all))
+	for _, a := range all {
+		aa = append(aa, attrJSON{
+			Handle:    a.h,
+			EndHandle: a.endh,
+			Type:      a.typ.String(),
+			Value:     a.v,
+			Dynamic:   a.rh != nil,
+			Writable:  a.wh != nil,
+			Hidden:    a.hidden,
+			WriteOnly: a.writeOnly,
+		})
+	}
+	return json.Marshal(aa)
+}
+
+// UnmarshalJSON loads the layout of the attributes marshaled by MarshalJSON.
+// Only the static parts are restored; the dynamic or writable attributes are
+// loaded without handlers, which must be re-attached by the upper layer, e.g.
+// with a DefaultReadHandler, before they can be read or written.
+func (r *DB) UnmarshalJSON(b []byte) error {
+	var aa []attrJSON
+	if err := json.Unmarshal(b, &aa); err != nil {
+		return err
+	}
+	attrs := make([]*attr, 0, len(aa))
+	for i, a := range aa {
+		if a.Handle == 0 || i > 0 && a.Handle != aa[0].Handle+uint16(i) {
+			return fmt.Errorf("non-contiguous handle 0x%04X", a.Handle)
+		}
+		u, err := ble.Parse(a.Type)
+		if err != nil {
+			return fmt.Errorf("attribute 0x%04X: %s", a.Handle, err)
+		}
+		attrs = append(attrs, &attr{
+			h:         a.Handle,
+			endh:      a.EndHandle,
+			typ:       u,
+			v:         a.Value,
+			hidden:    a.Hidden,
+			writeOnly: a.WriteOnly,
+		})
+	}
+	*r = DB{attrs: attrs}
+	if len(aa) > 0 {
+		r.base = aa[0].Handle
+	}
+	r.index()
+	return nil
+}
+
+// checkProperty cross-checks the properties of c against its handlers, so
+// the misconfigurations are reported before any request fails at runtime.
+// A readable value without a static value or a ReadHandler is allowed, as
+// it's served by the DefaultReadHandler of the Server, e.g. in a proxy.
+func checkProperty(c *ble.Characteristic) error {
+	switch p := c.Property; {
+	case p&(ble.CharWrite|ble.CharWriteNR) != 0 && c.WriteHandler == nil:
+		return fmt.Errorf("write property without write handler")
+	case p&ble.CharNotify != 0 && c.NotifyHandler == nil && c.CCCD == nil:
+		return fmt.Errorf("notify property without notify handler or CCCD")
+	case p&ble.CharIndicate != 0 && c.IndicateHandler == nil && c.CCCD == nil:
+		return fmt.Errorf("indicate property without indicate handler or CCCD")
+	}
+	return nil
+}
+
+// RebaseDB returns a DB of the services of db, whose handles are reassigned
+// contiguously from base, e.g. to embed a module at a known range of handles.
+// As with MergeDBs, the handles referenced by the declarations, and the ones
+// kept by the characteristics and descriptors are updated accordingly, so db
+// must not be served anymore. A DB loaded by UnmarshalJSON can't be rebased,
+// as it has no services.
+func RebaseDB(db *DB, base uint16) (*DB, error) {
+	if db.svcs == nil {
+		return nil, fmt.Errorf("no services to rebase")
+	}
+	return BuildDB(db.svcs, base)
+}
+
+func containsService(ss []*ble.Service, s *ble.Service) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func checkUUID(u ble.UUID) error {
+	if u.Len() != 2 && u.Len() != 16 {
+		return fmt.Errorf("invalid UUID length %d", u.Len())
+	}
+	return nil
+}
+
+// RecalculateGroupEnds sets the End Group Handle of each service declaration
+// to the handle just before the next service declaration. The last service
+// ends at 0xFFFF. It's called by NewDB, and should be called again if the
+// attributes are changed afterwards.
+func (r *DB) RecalculateGroupEnds() {
+	var last *attr
+	for _, a := range r.attrs {
+		if !a.typ.Equal(ble.PrimaryServiceUUID) && !a.typ.Equal(ble.SecondaryServiceUUID) {
+			continue
+		}
+		if last != nil {
+			last.endh = a.h - 1
+		}
+		last = a
+	}
+	if last != nil {
+		last.endh = 0xFFFF
+	}
+}
+
+// genSvcAttr generates the attributes of the service s starting at handle h.
+// The declarations always have static values, which are served as is to
+// Read Requests, and never passed to the upper layer. [Vol 3, Part G, 3.1 & 3.3.1]
 func genSvcAttr(s *ble.Service, h uint16) (uint16, []*attr) {
 	a := &attr{
 		h:   h,
 		typ: ble.PrimaryServiceUUID,
 		v:   s.UUID,
 	}
+	s.Handle = h
 	h++
 	attrs := []*attr{a}
 	var aa []*attr
 
+	for range s.Includes {
+		attrs = append(attrs, &attr{h: h, typ: ble.IncludeUUID})
+		h++
+	}
+
 	for _, c := range s.Characteristics {
 		h, aa = genCharAttr(c, h)
 		attrs = append(attrs, aa...)
 	}
 
 	a.endh = h - 1
+	s.EndHandle = a.endh
 	return h, attrs
 }
 
@@ -100,22 +441,26 @@ func genCharAttr(c *ble.Characteristic, h uint16) (uint16, []*attr) {
 	vh := h + 1
 
 	a := &attr{
-		h:   h,
-		typ: ble.CharacteristicUUID,
-		v:   append([]byte{byte(c.Property), byte(vh), byte((vh) >> 8)}, c.UUID...),
+		h:      h,
+		typ:    ble.CharacteristicUUID,
+		v:      CharacteristicDeclaration(c.Property, vh, c.UUID),
+		hidden: c.Hidden,
 	}
 
 	va := &attr{
-		h:   vh,
-		typ: c.UUID,
-		v:   c.Value,
-		rh:  c.ReadHandler,
-		wh:  c.WriteHandler,
+		h:      vh,
+		typ:    c.UUID,
+		v:      c.Value,
+		rh:     c.ReadHandler,
+		wh:     c.WriteHandler,
+		hidden: c.Hidden,
+
+		writeOnly: writeOnly(c.Property),
 	}
 
 	c.Handle = h
 	c.ValueHandle = vh
-	if c.NotifyHandler != nil || c.IndicateHandler != nil {
+	if c.CCCD == nil && (c.NotifyHandler != nil || c.IndicateHandler != nil) {
 		c.CCCD = newCCCD(c)
 		c.Descriptors = append(c.Descriptors, c.CCCD)
 	}
@@ -124,7 +469,9 @@ func genCharAttr(c *ble.Characteristic, h uint16) (uint16, []*attr) {
 
 	attrs := []*attr{a, va}
 	for _, d := range c.Descriptors {
-		attrs = append(attrs, genDescAttr(d, h))
+		da := genDescAttr(d, h)
+		da.hidden = da.hidden || c.Hidden
+		attrs = append(attrs, da)
 		h++
 	}
 
@@ -133,12 +480,16 @@ func genCharAttr(c *ble.Characteristic, h uint16) (uint16, []*attr) {
 }
 
 func genDescAttr(d *ble.Descriptor, h uint16) *attr {
+	d.Handle = h
 	return &attr{
-		h:   h,
-		typ: d.UUID,
-		v:   d.Value,
-		rh:  d.ReadHandler,
-		wh:  d.WriteHandler,
+		h:      h,
+		typ:    d.UUID,
+		v:      d.Value,
+		rh:     d.ReadHandler,
+		wh:     d.WriteHandler,
+		hidden: d.Hidden,
+
+		writeOnly: writeOnly(d.Property),
 	}
 }
 
@@ -147,11 +498,16 @@ func DumpAttributes(aa []*attr) {
 	logger.Debug("server", "db", "Generating attribute table:")
 	logger.Debug("server", "db", "handle   endh   type")
 	for _, a := range aa {
+		// Name falls back to the UUID itself, which is already printed.
+		name := ble.Name(a.typ)
+		if name == a.typ.String() {
+			name = ""
+		}
 		if a.v != nil {
-			logger.Debug("server", "db", fmt.Sprintf("0x%04X 0x%04X 0x%s [% X]", a.h, a.endh, a.typ, a.v))
+			logger.Debug("server", "db", fmt.Sprintf("0x%04X 0x%04X 0x%s [% X] %s", a.h, a.endh, a.typ, a.v, name))
 			continue
 		}
-		logger.Debug("server", "db", fmt.Sprintf("0x%04X 0x%04X 0x%s", a.h, a.endh, a.typ))
+		logger.Debug("server", "db", fmt.Sprintf("0x%04X 0x%04X 0x%s %s", a.h, a.endh, a.typ, name))
 	}
 }
 
@@ -164,13 +520,26 @@ func newCCCD(c *ble.Characteristic) *ble.Descriptor {
 	d := ble.NewDescriptor(ble.ClientCharacteristicConfigUUID)
 
 	d.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
-		cccs := req.Conn().(*conn).cccs
-		ccc := cccs[c.Handle]
-		binary.Write(rsp, binary.LittleEndian, ccc)
+		cn, ok := req.Conn().(*conn)
+		if !ok {
+			rsp.SetStatus(ble.ErrUnlikely)
+			return
+		}
+		binary.Write(rsp, binary.LittleEndian, cn.ccc(c.Handle))
 	}))
 
 	d.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
-		cn := req.Conn().(*conn)
+		cn, ok := req.Conn().(*conn)
+		if !ok {
+			rsp.SetStatus(ble.ErrUnlikely)
+			return
+		}
+		cn.mu.Lock()
+		defer cn.mu.Unlock()
+		if len(req.Data()) != 2 {
+			rsp.SetStatus(ble.ErrInvalAttrValueLen)
+			return
+		}
 		old := cn.cccs[c.Handle]
 		ccc := binary.LittleEndian.Uint16(req.Data())
 
@@ -179,11 +548,21 @@ func newCCCD(c *ble.Characteristic) *ble.Descriptor {
 		newNotify := ccc&cccNotify != 0
 		newIndicate := ccc&cccIndicate != 0
 
+		// Validate the value before making any change to the subscriptions.
+		switch {
+		case ccc&^(cccNotify|cccIndicate) != 0:
+			// Reserved bits.
+			rsp.SetStatus(ble.ErrWriteNotPerm)
+			return
+		case newNotify && c.Property&ble.CharNotify == 0:
+			rsp.SetStatus(ble.ErrWriteNotPerm)
+			return
+		case newIndicate && c.Property&ble.CharIndicate == 0:
+			rsp.SetStatus(ble.ErrWriteNotPerm)
+			return
+		}
+
 		if newNotify && !oldNotify {
-			if c.Property&ble.CharNotify == 0 {
-				rsp.SetStatus(ble.ErrUnlikely)
-				return
-			}
 			send := func(b []byte) (int, error) { return cn.svr.notify(c.ValueHandle, b) }
 			cn.nn[c.Handle] = ble.NewNotifier(send)
 			go c.NotifyHandler.ServeNotify(req, cn.nn[c.Handle])
@@ -193,11 +572,7 @@ func newCCCD(c *ble.Characteristic) *ble.Descriptor {
 		}
 
 		if newIndicate && !oldIndicate {
-			if c.Property&ble.CharIndicate == 0 {
-				rsp.SetStatus(ble.ErrUnlikely)
-				return
-			}
-			send := func(b []byte) (int, error) { return cn.svr.indicate(c.ValueHandle, b) }
+			send := func(b []byte) (int, error) { return cn.svr.indicate(c.ValueHandle, b, cn.svr.IndicationTimeout) }
 			cn.in[c.Handle] = ble.NewNotifier(send)
 			go c.IndicateHandler.ServeNotify(req, cn.in[c.Handle])
 		}
@@ -205,6 +580,12 @@ func newCCCD(c *ble.Characteristic) *ble.Descriptor {
 			cn.in[c.Handle].Close()
 		}
 		cn.cccs[c.Handle] = ccc
+
+		if st := cn.svr.CCCDStore; st != nil {
+			if err := st.Save(cn.RemoteAddr(), c.CCCD.Handle, ccc); err != nil {
+				logger.Error("server", "ccc", fmt.Sprintf("can't save: %s", err))
+			}
+		}
 	}))
 	return d
 }
@@ -0,0 +1,318 @@
+package att
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestWriteOnlyControlPoint(t *testing.T) {
+	var written [][]byte
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	cp := svc.NewCharacteristic(ble.UUID16(0xFFF1))
+	cp.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		written = append(written, append([]byte{}, req.Data()...))
+	}))
+	cp.Property |= ble.CharWriteNR
+	// A ReadHandler without the Read property must never be invoked.
+	cp.ReadHandler = ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		t.Error("ReadHandler of a write-only attribute invoked")
+		rsp.Write([]byte{0xFF})
+	})
+	_, c := newTestServer(t, []*ble.Service{svc})
+
+	const h = 0x0003
+	for _, req := range [][]byte{
+		pdu(ReadRequestCode, uint16(h)),
+		pdu(ReadBlobRequestCode, uint16(h), uint16(0)),
+		pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.UUID16(0xFFF1)),
+		pdu(ReadMultipleRequestCode, uint16(0x0002), uint16(h)),
+	} {
+		if b, want := c.request(t, req), newErrorResponse(req[0], h, ble.ErrReadNotPerm); !bytes.Equal(b, want) {
+			t.Errorf("[% X]: got [% X], want [% X]", req, b, want)
+		}
+	}
+
+	if b := c.request(t, pdu(WriteRequestCode, uint16(h), 0x01)); !bytes.Equal(b, []byte{WriteResponseCode}) {
+		t.Fatalf("write: got [% X]", b)
+	}
+	c.in <- pdu(WriteCommandCode, uint16(h), 0x02)
+	// The Read Request following the command makes sure it has been handled.
+	c.request(t, pdu(ReadRequestCode, uint16(h)))
+	if len(written) != 2 || !bytes.Equal(written[0], []byte{0x01}) || !bytes.Equal(written[1], []byte{0x02}) {
+		t.Errorf("written [% X]", written)
+	}
+}
+
+func TestGroupEnds(t *testing.T) {
+	gap := ble.NewService(ble.GAPUUID)
+	gap.NewCharacteristic(ble.DeviceNameUUID).SetValue([]byte("Gopher"))
+	gap.NewCharacteristic(ble.AppearanceUUID).HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {}))
+	bas := ble.NewService(ble.BatteryUUID)
+	bas.NewCharacteristic(ble.BatteryLevelUUID).SetValue([]byte{99})
+	empty := ble.NewService(ble.UUID16(0x1811))
+	ss := []*ble.Service{gap, bas, empty}
+
+	db := NewDB(ss, 1)
+	for _, tc := range []struct {
+		s          *ble.Service
+		start, end uint16
+	}{
+		{gap, 0x0001, 0x0006},
+		{bas, 0x0007, 0x0009},
+		{empty, 0x000A, 0xFFFF},
+	} {
+		a, ok := db.at(tc.start)
+		if !ok {
+			t.Fatalf("%s: no declaration at 0x%04X", tc.s.UUID, tc.start)
+		}
+		if tc.s.Handle != tc.start || a.endh != tc.end {
+			t.Errorf("%s: [0x%04X, 0x%04X], want [0x%04X, 0x%04X]", tc.s.UUID, tc.s.Handle, a.endh, tc.start, tc.end)
+		}
+	}
+
+	// The services are discovered with the group ends.
+	_, c := newTestServer(t, ss)
+	want := pdu(ReadByGroupTypeResponseCode, 6,
+		uint16(0x0001), uint16(0x0006), ble.GAPUUID,
+		uint16(0x0007), uint16(0x0009), ble.BatteryUUID,
+		uint16(0x000A), uint16(0xFFFF), ble.UUID16(0x1811))
+	if b := c.request(t, pdu(ReadByGroupTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.PrimaryServiceUUID)); !bytes.Equal(b, want) {
+		t.Errorf("got [% X], want [% X]", b, want)
+	}
+
+	// Removing the last service leaves the Battery Service last.
+	db.attrs = db.attrs[:9]
+	db.RecalculateGroupEnds()
+	if a, _ := db.at(0x0007); a.endh != 0xFFFF {
+		t.Errorf("Battery Service ends at 0x%04X, want 0xFFFF", a.endh)
+	}
+	if a, _ := db.at(0x0001); a.endh != 0x0006 {
+		t.Errorf("GAP Service ends at 0x%04X, want 0x0006", a.endh)
+	}
+}
+
+func TestCheckProperty(t *testing.T) {
+	nop := ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {})
+	for _, tc := range []struct {
+		name  string
+		setup func(c *ble.Characteristic)
+		err   string
+	}{
+		{"write", func(c *ble.Characteristic) { c.Property = ble.CharWrite }, "write property without write handler"},
+		{"write without response", func(c *ble.Characteristic) { c.Property = ble.CharWriteNR }, "write property without write handler"},
+		{"notify", func(c *ble.Characteristic) { c.Property = ble.CharNotify }, "notify property without notify handler or CCCD"},
+		{"indicate", func(c *ble.Characteristic) { c.Property = ble.CharIndicate }, "indicate property without indicate handler or CCCD"},
+		{"indicate with notify handler", func(c *ble.Characteristic) {
+			c.HandleNotify(nop)
+			c.Property |= ble.CharIndicate
+		}, "indicate property without indicate handler or CCCD"},
+		// Served by the DefaultReadHandler of the Server.
+		{"read", func(c *ble.Characteristic) { c.Property = ble.CharRead }, ""},
+		{"notify with CCCD", func(c *ble.Characteristic) {
+			c.Property = ble.CharNotify
+			c.CCCD = c.NewDescriptor(ble.ClientCharacteristicConfigUUID)
+		}, ""},
+		{"handlers", func(c *ble.Characteristic) {
+			c.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {}))
+			c.HandleNotify(nop)
+			c.HandleIndicate(nop)
+		}, ""},
+	} {
+		s := ble.NewService(ble.UUID16(0xFFF0))
+		tc.setup(s.NewCharacteristic(ble.UUID16(0xFFF1)))
+		_, err := BuildDB([]*ble.Service{s}, 1)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestCharacteristicsWithProperty(t *testing.T) {
+	nopWrite := ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {})
+	nopNotify := ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {})
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).SetValue([]byte{0x01})
+	rw := svc.NewCharacteristic(ble.UUID16(0xFFF2))
+	rw.SetValue([]byte{0x02})
+	rw.HandleWrite(nopWrite)
+	svc.NewCharacteristic(ble.UUID16(0xFFF3)).HandleNotify(nopNotify)
+	svc.NewCharacteristic(ble.UUID16(0xFFF4)).HandleIndicate(nopNotify)
+	both := svc.NewCharacteristic(ble.UUID16(0xFFF5))
+	both.HandleNotify(nopNotify)
+	both.HandleIndicate(nopNotify)
+	cmd := svc.NewCharacteristic(ble.UUID16(0xFFF6))
+	cmd.HandleWrite(nopWrite)
+	cmd.Property = ble.CharWriteNR
+	hidden := svc.NewCharacteristic(ble.UUID16(0xFFF7))
+	hidden.HandleNotify(nopNotify)
+	hidden.Hidden = true
+	db := NewDB([]*ble.Service{svc}, 1)
+
+	for _, tc := range []struct {
+		prop ble.Property
+		want []uint16
+	}{
+		{ble.CharRead, []uint16{0xFFF1, 0xFFF2}},
+		{ble.CharWrite, []uint16{0xFFF2}},
+		{ble.CharRead | ble.CharWrite, []uint16{0xFFF2}},
+		{ble.CharWriteNR, []uint16{0xFFF2, 0xFFF6}},
+		{ble.CharNotify, []uint16{0xFFF3, 0xFFF5, 0xFFF7}},
+		{ble.CharIndicate, []uint16{0xFFF4, 0xFFF5}},
+		{ble.CharNotify | ble.CharIndicate, []uint16{0xFFF5}},
+		{ble.CharBroadcast, nil},
+		{0, []uint16{0xFFF1, 0xFFF2, 0xFFF3, 0xFFF4, 0xFFF5, 0xFFF6, 0xFFF7}},
+	} {
+		cc := db.CharacteristicsWithProperty(tc.prop)
+		var got []uint16
+		for _, c := range cc {
+			got = append(got, binary.LittleEndian.Uint16(c.UUID))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("0x%02X: got %X, want %X", tc.prop, got, tc.want)
+			continue
+		}
+		for i, c := range cc {
+			ch := svc.Characteristics[binary.LittleEndian.Uint16(c.UUID)-0xFFF1]
+			if c.Handle != ch.Handle || c.ValueHandle != ch.ValueHandle || c.Property != ch.Property {
+				t.Errorf("0x%02X: %d: got 0x%04X 0x%04X 0x%02X, want 0x%04X 0x%04X 0x%02X",
+					tc.prop, i, c.Handle, c.ValueHandle, c.Property, ch.Handle, ch.ValueHandle, ch.Property)
+			}
+		}
+	}
+}
+
+func TestRebaseDB(t *testing.T) {
+	bas := ble.NewService(ble.BatteryUUID)
+	bas.NewCharacteristic(ble.BatteryLevelUUID).SetValue([]byte{99})
+	ss := testServices()
+	ss[0].Includes = []*ble.Service{bas}
+	ss = append(ss, bas)
+	old := NewDB(ss, 1)
+
+	// The handles of the declarations, characteristics and descriptors.
+	type handles struct{ svc, incl, decl, value, cccd []uint16 }
+	collect := func() (h handles) {
+		for _, s := range ss {
+			h.svc = append(h.svc, s.Handle, s.EndHandle)
+			for _, in := range s.Includes {
+				h.incl = append(h.incl, in.Handle, in.EndHandle)
+			}
+			for _, c := range s.Characteristics {
+				h.decl = append(h.decl, c.Handle)
+				h.value = append(h.value, c.ValueHandle)
+				if c.CCCD != nil {
+					h.cccd = append(h.cccd, c.CCCD.Handle)
+				}
+			}
+		}
+		return h
+	}
+	before := collect()
+
+	const base = 0x0100
+	db, err := RebaseDB(old, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := collect()
+	shifted := func(hh []uint16) []uint16 {
+		var r []uint16
+		for _, h := range hh {
+			r = append(r, h+base-1)
+		}
+		return r
+	}
+	for _, tc := range []struct {
+		name          string
+		before, after []uint16
+	}{
+		{"services", before.svc, after.svc},
+		{"included services", before.incl, after.incl},
+		{"declarations", before.decl, after.decl},
+		{"values", before.value, after.value},
+		{"CCCDs", before.cccd, after.cccd},
+	} {
+		if want := shifted(tc.before); fmt.Sprint(tc.after) != fmt.Sprint(want) {
+			t.Errorf("%s at %04X, want %04X", tc.name, tc.after, want)
+		}
+	}
+
+	// The declarations reference the rebased handles.
+	for _, s := range ss {
+		for i, in := range s.Includes {
+			a, _ := db.at(s.Handle + 1 + uint16(i))
+			if want := IncludeDeclaration(in.Handle, in.EndHandle, in.UUID); !bytes.Equal(a.v, want) {
+				t.Errorf("include 0x%04X: [% X], want [% X]", a.h, a.v, want)
+			}
+		}
+		for _, c := range s.Characteristics {
+			a, _ := db.at(c.Handle)
+			if _, vh, _, _ := ParseCharacteristicDeclaration(a.v); vh != c.ValueHandle {
+				t.Errorf("characteristic 0x%04X: value at 0x%04X, want 0x%04X", c.Handle, vh, c.ValueHandle)
+			}
+		}
+	}
+	if a, _ := db.at(ss[0].Handle); a.endh != ss[0].EndHandle {
+		t.Errorf("GAP Service ends at 0x%04X, want 0x%04X", a.endh, ss[0].EndHandle)
+	}
+
+	// The CCCD of the Appearance subscribes it at its rebased handles.
+	s, c := newTestServerDB(t, db)
+	cccd := ss[0].Characteristics[1].CCCD.Handle
+	if b := c.request(t, pdu(WriteRequestCode, cccd, uint16(cccNotify))); !bytes.Equal(b, []byte{WriteResponseCode}) {
+		t.Fatalf("subscribe: got [% X]", b)
+	}
+	if !s.subscribed(ss[0].Characteristics[1].ValueHandle, false) {
+		t.Error("the rebased Appearance isn't subscribed")
+	}
+}
+
+func TestHash(t *testing.T) {
+	svc := ble.NewService(ble.GAPUUID)
+	svc.NewCharacteristic(ble.DeviceNameUUID).SetValue([]byte("Gopher"))
+	c := svc.NewCharacteristic(ble.AppearanceUUID)
+	c.SetValue([]byte{0x80, 0x00})
+	c.HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {}))
+	c.NewDescriptor(ble.UserDescriptionUUID).SetValue([]byte("Appearance"))
+	custom := ble.NewService(ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7"))
+	custom.NewCharacteristic(ble.MustParse("8E5F2C1A-64C0-4C8B-9B4C-3A1F2E6D7B90")).SetValue([]byte{0x01})
+	db := NewDB([]*ble.Service{svc, custom}, 1)
+
+	// The declarations are covered with their values, the descriptors
+	// without, and the characteristic values not at all. [Vol 3, Part G, 7.3.1]
+	m := pdu(
+		uint16(0x0001), ble.PrimaryServiceUUID, ble.GAPUUID,
+		uint16(0x0002), ble.CharacteristicUUID, byte(ble.CharRead), uint16(0x0003), ble.DeviceNameUUID,
+		uint16(0x0004), ble.CharacteristicUUID, byte(ble.CharRead|ble.CharNotify), uint16(0x0005), ble.AppearanceUUID,
+		uint16(0x0006), ble.UserDescriptionUUID,
+		uint16(0x0007), ble.ClientCharacteristicConfigUUID,
+		uint16(0x0008), ble.PrimaryServiceUUID, custom.UUID,
+		uint16(0x0009), ble.CharacteristicUUID, byte(ble.CharRead), uint16(0x000A), custom.Characteristics[0].UUID,
+	)
+	// The hash is transmitted in the reverse order of the AES-CMAC.
+	hash := func(m []byte) (h [16]byte) {
+		mac := aesCMAC(make([]byte, 16), m)
+		for i := range mac {
+			h[i] = mac[15-i]
+		}
+		return h
+	}
+	if h, want := db.Hash(), hash(m); h != want {
+		t.Errorf("got % X, want % X", h, want)
+	}
+
+	// Hidden attributes aren't covered.
+	c.Descriptors[0].Hidden = true
+	m = append(m[:24:24], m[28:]...) // The User Description at 0x0006.
+	if h, want := NewDB([]*ble.Service{svc, custom}, 1).Hash(), hash(m); h != want {
+		t.Errorf("hidden descriptor: got % X, want % X", h, want)
+	}
+}
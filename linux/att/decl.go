@@ -0,0 +1,41 @@
+package att
+
+import (
+	"encoding/binary"
+
+	"github.com/currantlabs/ble"
+)
+
+// CharacteristicDeclaration returns the value of a Characteristic Declaration,
+// which consists of the properties, the handle of the value attribute, and
+// the UUID of the characteristic. The value is 5 or 19 bytes long, depending
+// on the UUID being 16-bit or 128-bit. [Vol 3, Part G, 3.3.1]
+func CharacteristicDeclaration(prop ble.Property, vh uint16, u ble.UUID) []byte {
+	b := make([]byte, 3, 3+len(u))
+	b[0] = byte(prop)
+	binary.LittleEndian.PutUint16(b[1:], vh)
+	return append(b, u...)
+}
+
+// IncludeDeclaration returns the value of an Include Declaration, which
+// consists of the handle range of the included service, and its UUID. The
+// UUID is only present if it's 16-bit, so the value is 6 or 4 bytes long.
+// [Vol 3, Part G, 3.2]
+func IncludeDeclaration(start, end uint16, u ble.UUID) []byte {
+	b := make([]byte, 4, 6)
+	binary.LittleEndian.PutUint16(b, start)
+	binary.LittleEndian.PutUint16(b[2:], end)
+	if u.Len() == 2 {
+		b = append(b, u...)
+	}
+	return b
+}
+
+// ParseCharacteristicDeclaration decodes the value of a Characteristic Declaration.
+// It returns false if b is neither 5 nor 19 bytes long.
+func ParseCharacteristicDeclaration(b []byte) (prop ble.Property, vh uint16, u ble.UUID, ok bool) {
+	if len(b) != 5 && len(b) != 19 {
+		return 0, 0, nil, false
+	}
+	return ble.Property(b[0]), binary.LittleEndian.Uint16(b[1:]), ble.UUID(b[3:]), true
+}
@@ -0,0 +1,184 @@
+package att
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestCharacteristicDeclaration(t *testing.T) {
+	for _, tc := range []struct {
+		prop ble.Property
+		vh   uint16
+		u    ble.UUID
+		len  int
+	}{
+		{ble.CharRead, 0x0003, ble.DeviceNameUUID, 5},
+		{ble.CharRead | ble.CharWrite | ble.CharNotify, 0xFFFF, ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7"), 19},
+	} {
+		b := CharacteristicDeclaration(tc.prop, tc.vh, tc.u)
+		if len(b) != tc.len {
+			t.Errorf("%s: %d bytes, want %d", tc.u, len(b), tc.len)
+		}
+		prop, vh, u, ok := ParseCharacteristicDeclaration(b)
+		if !ok || prop != tc.prop || vh != tc.vh || !u.Equal(tc.u) {
+			t.Errorf("%s: decoded to 0x%02X, 0x%04X, %s, %t", tc.u, prop, vh, u, ok)
+		}
+	}
+	for _, n := range []int{0, 4, 6, 18, 20} {
+		if _, _, _, ok := ParseCharacteristicDeclaration(make([]byte, n)); ok {
+			t.Errorf("%d bytes decoded", n)
+		}
+	}
+}
+
+func TestIncludeDeclaration(t *testing.T) {
+	if b, want := IncludeDeclaration(0x0010, 0x0020, ble.BatteryUUID), pdu(uint16(0x0010), uint16(0x0020), ble.BatteryUUID); !bytes.Equal(b, want) {
+		t.Errorf("16-bit UUID: got [% X], want [% X]", b, want)
+	}
+	// 128-bit UUIDs are left out, and read from the included service.
+	u := ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7")
+	if b, want := IncludeDeclaration(0x0010, 0x0020, u), pdu(uint16(0x0010), uint16(0x0020)); !bytes.Equal(b, want) {
+		t.Errorf("128-bit UUID: got [% X], want [% X]", b, want)
+	}
+}
+
+// TestDiscoverCharacteristics walks the services with Read By Type Requests
+// of the Characteristic Declarations, as clients discover the characteristics,
+// and decodes the declarations back to the characteristics served.
+func TestDiscoverCharacteristics(t *testing.T) {
+	// Along with the 16-bit UUIDs of testServices, serve a 128-bit one.
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.MustParse("8E5F2C1A-64C0-4C8B-9B4C-3A1F2E6D7B90")).HandleWrite(
+		ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {}))
+	ss := append(testServices(), svc)
+	_, c := newTestServer(t, ss)
+
+	var want []*ble.Characteristic
+	for _, s := range ss {
+		want = append(want, s.Characteristics...)
+	}
+	var got []*ble.Characteristic
+	for start := uint16(0x0001); ; {
+		b := c.request(t, pdu(ReadByTypeRequestCode, start, uint16(0xFFFF), ble.CharacteristicUUID))
+		if b[0] == ErrorResponseCode {
+			break
+		}
+		// Each entry is the handle of the declaration, followed by its value.
+		n := int(b[1])
+		if b[0] != ReadByTypeResponseCode || (n != 7 && n != 21) || (len(b)-2)%n != 0 {
+			t.Fatalf("malformed response [% X]", b)
+		}
+		for e := b[2:]; len(e) != 0; e = e[n:] {
+			h := binary.LittleEndian.Uint16(e)
+			prop, vh, u, ok := ParseCharacteristicDeclaration(e[2:n])
+			if !ok {
+				t.Fatalf("malformed declaration [% X]", e[:n])
+			}
+			got = append(got, &ble.Characteristic{UUID: u, Property: prop, Handle: h, ValueHandle: vh})
+			start = h + 1
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("discovered %d characteristics, want %d", len(got), len(want))
+	}
+	for i, c := range want {
+		g := got[i]
+		if !g.UUID.Equal(c.UUID) || g.Property != c.Property || g.Handle != c.Handle || g.ValueHandle != c.ValueHandle {
+			t.Errorf("discovered %s 0x%02X 0x%04X 0x%04X, want %s 0x%02X 0x%04X 0x%04X",
+				g.UUID, g.Property, g.Handle, g.ValueHandle, c.UUID, c.Property, c.Handle, c.ValueHandle)
+		}
+	}
+}
+
+// TestReadDeclarations reads the declarations of the services and of the
+// characteristics with Read Requests, and decodes them back to the
+// definitions served.
+func TestReadDeclarations(t *testing.T) {
+	ss := testServices()
+	_, c := newTestServer(t, ss)
+	for _, s := range ss {
+		b := c.request(t, pdu(ReadRequestCode, s.Handle))
+		if b[0] != ReadResponseCode {
+			t.Fatalf("service 0x%04X: got [% X]", s.Handle, b)
+		}
+		if u := ble.UUID(b[1:]); !u.Equal(s.UUID) {
+			t.Errorf("service 0x%04X: decoded to %s, want %s", s.Handle, u, s.UUID)
+		}
+		for _, ch := range s.Characteristics {
+			b := c.request(t, pdu(ReadRequestCode, ch.Handle))
+			if b[0] != ReadResponseCode {
+				t.Fatalf("characteristic 0x%04X: got [% X]", ch.Handle, b)
+			}
+			prop, vh, u, ok := ParseCharacteristicDeclaration(b[1:])
+			if !ok || prop != ch.Property || vh != ch.ValueHandle || !u.Equal(ch.UUID) {
+				t.Errorf("characteristic 0x%04X: decoded to 0x%02X, 0x%04X, %s, %t, want 0x%02X, 0x%04X, %s",
+					ch.Handle, prop, vh, u, ok, ch.Property, ch.ValueHandle, ch.UUID)
+			}
+		}
+	}
+}
+
+// TestDiscoverIncludes discovers the services included in a primary service
+// with Read By Type Requests of the Include Declarations, and reads the
+// 128-bit UUIDs, which are left out, from the included service declarations.
+func TestDiscoverIncludes(t *testing.T) {
+	bas := ble.NewService(ble.BatteryUUID)
+	bas.NewCharacteristic(ble.BatteryLevelUUID).SetValue([]byte{99})
+	custom := ble.NewService(ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7"))
+	custom.NewCharacteristic(ble.UUID16(0xFFF1)).SetValue([]byte{0x01})
+	gap := ble.NewService(ble.GAPUUID)
+	gap.Includes = []*ble.Service{bas, custom}
+	gap.NewCharacteristic(ble.DeviceNameUUID).SetValue([]byte("Gopher"))
+	db, err := BuildDB([]*ble.Service{gap, bas, custom}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestConn(ble.MaxMTU)
+	s, err := NewServer(db, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*ble.Service
+	for start := gap.Handle; ; {
+		b := s.ProcessRequest(pdu(ReadByTypeRequestCode, start, gap.EndHandle, ble.IncludeUUID))
+		if b[0] == ErrorResponseCode {
+			break
+		}
+		// Each entry is the handle of the declaration, followed by the
+		// handle range of the included service, and its 16-bit UUID if any.
+		n := int(b[1])
+		if b[0] != ReadByTypeResponseCode || (n != 6 && n != 8) || (len(b)-2)%n != 0 {
+			t.Fatalf("malformed response [% X]", b)
+		}
+		for e := b[2:]; len(e) != 0; e = e[n:] {
+			in := &ble.Service{
+				Handle:    binary.LittleEndian.Uint16(e[2:]),
+				EndHandle: binary.LittleEndian.Uint16(e[4:]),
+				UUID:      ble.UUID(e[6:n]),
+			}
+			if n == 6 {
+				r := s.ProcessRequest(pdu(ReadRequestCode, in.Handle))
+				if r[0] != ReadResponseCode {
+					t.Fatalf("read of the service declaration 0x%04X: got [% X]", in.Handle, r)
+				}
+				in.UUID = ble.UUID(r[1:])
+			}
+			got = append(got, in)
+			start = binary.LittleEndian.Uint16(e) + 1
+		}
+	}
+	if len(got) != len(gap.Includes) {
+		t.Fatalf("discovered %d included services, want %d", len(got), len(gap.Includes))
+	}
+	for i, in := range gap.Includes {
+		g := got[i]
+		if !g.UUID.Equal(in.UUID) || g.Handle != in.Handle || g.EndHandle != in.EndHandle {
+			t.Errorf("discovered %s [0x%04X, 0x%04X], want %s [0x%04X, 0x%04X]",
+				g.UUID, g.Handle, g.EndHandle, in.UUID, in.Handle, in.EndHandle)
+		}
+	}
+}
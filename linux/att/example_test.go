@@ -0,0 +1,166 @@
+package att_test
+
+import (
+	"fmt"
+
+	"github.com/currantlabs/ble"
+	"github.com/currantlabs/ble/linux/att"
+	"golang.org/x/net/context"
+)
+
+// exampleConn is a ble.Conn, which isn't read by the examples, as the Servers
+// are not looping, and prints the PDUs sent.
+type exampleConn struct {
+	rxMTU, txMTU int
+	ctx          context.Context
+	closed       chan struct{}
+}
+
+func (c *exampleConn) Read(b []byte) (int, error) {
+	<-c.closed
+	return 0, fmt.Errorf("closed")
+}
+
+func (c *exampleConn) Write(b []byte) (int, error) {
+	fmt.Printf("sent % X\n", b)
+	return len(b), nil
+}
+
+func (c *exampleConn) Close() error                   { close(c.closed); return nil }
+func (c *exampleConn) Context() context.Context       { return c.ctx }
+func (c *exampleConn) SetContext(ctx context.Context) { c.ctx = ctx }
+func (c *exampleConn) LocalAddr() ble.Addr            { return ble.NewAddr("11:22:33:44:55:66") }
+func (c *exampleConn) RemoteAddr() ble.Addr           { return ble.NewAddr("AA:BB:CC:DD:EE:FF") }
+func (c *exampleConn) RxMTU() int                     { return c.rxMTU }
+func (c *exampleConn) SetRxMTU(mtu int)               { c.rxMTU = mtu }
+func (c *exampleConn) TxMTU() int                     { return c.txMTU }
+func (c *exampleConn) SetTxMTU(mtu int)               { c.txMTU = mtu }
+func (c *exampleConn) Disconnected() <-chan struct{}  { return c.closed }
+
+// newExampleServer returns a Server, which is not looping, of the attributes:
+//
+//	0x0001 GAP Service
+//	0x0002 Device Name declaration
+//	0x0003 Device Name "Gopher, the long-named device"
+//	0x0004 Appearance declaration
+//	0x0005 Appearance 0x0080
+//	0x0006 Service 0xFFF0
+//	0x0007 Characteristic 0xFFF1 declaration
+//	0x0008 Characteristic 0xFFF1, which prints the values written
+func newExampleServer() *att.Server {
+	gap := ble.NewService(ble.GAPUUID)
+	gap.NewCharacteristic(ble.DeviceNameUUID).SetValue([]byte("Gopher, the long-named device"))
+	gap.NewCharacteristic(ble.AppearanceUUID).SetValue([]byte{0x80, 0x00})
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		fmt.Printf("written %q\n", req.Data())
+	}))
+	c := &exampleConn{rxMTU: ble.MaxMTU, txMTU: ble.DefaultMTU, ctx: context.Background(), closed: make(chan struct{})}
+	s, err := att.NewServer(att.NewDB([]*ble.Service{gap, svc}, 1), c)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// A Read Request of the Appearance.
+func ExampleServer_ProcessRequest() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.ReadRequestCode, 0x05, 0x00}))
+	// Output:
+	// 0B 80 00
+}
+
+func ExampleServer_ProcessRequest_exchangeMTU() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.ExchangeMTURequestCode, 0x00, 0x01}))
+	// Output:
+	// 03 03 02
+}
+
+func ExampleServer_ProcessRequest_findInformation() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.FindInformationRequestCode, 0x01, 0x00, 0xFF, 0xFF}))
+	// Output:
+	// 05 01 01 00 00 28 02 00 03 28 03 00 00 2A 04 00 03 28 05 00 01 2A
+}
+
+// Discover the handle range of the GAP Service.
+func ExampleServer_ProcessRequest_findByTypeValue() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.FindByTypeValueRequestCode, 0x01, 0x00, 0xFF, 0xFF, 0x00, 0x28, 0x00, 0x18}))
+	// Output:
+	// 07 01 00 05 00
+}
+
+// Discover the characteristics.
+func ExampleServer_ProcessRequest_readByType() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.ReadByTypeRequestCode, 0x01, 0x00, 0xFF, 0xFF, 0x03, 0x28}))
+	// Output:
+	// 09 07 02 00 02 03 00 00 2A 04 00 02 05 00 01 2A 07 00 0C 08 00 F1 FF
+}
+
+// Read the Device Name, which is too long for a Read Response.
+func ExampleServer_ProcessRequest_readBlob() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.ReadRequestCode, 0x03, 0x00}))
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.ReadBlobRequestCode, 0x03, 0x00, 0x16, 0x00}))
+	// Output:
+	// 0B 47 6F 70 68 65 72 2C 20 74 68 65 20 6C 6F 6E 67 2D 6E 61 6D 65 64
+	// 0D 20 64 65 76 69 63 65
+}
+
+func ExampleServer_ProcessRequest_readMultiple() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.ReadMultipleRequestCode, 0x05, 0x00, 0x02, 0x00}))
+	// Output:
+	// 0F 80 00 02 03 00 00 2A
+}
+
+// Discover the primary services.
+func ExampleServer_ProcessRequest_readByGroupType() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.ReadByGroupTypeRequestCode, 0x01, 0x00, 0xFF, 0xFF, 0x00, 0x28}))
+	// Output:
+	// 11 06 01 00 05 00 00 18 06 00 FF FF F0 FF
+}
+
+func ExampleServer_ProcessRequest_write() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.WriteRequestCode, 0x08, 0x00, 'o', 'n'}))
+	// Output:
+	// written "on"
+	// 13
+}
+
+// Write Commands are never responded.
+func ExampleServer_ProcessRequest_writeCommand() {
+	s := newExampleServer()
+	fmt.Printf("%d\n", len(s.ProcessRequest([]byte{att.WriteCommandCode, 0x08, 0x00, 'o', 'f', 'f'})))
+	// Output:
+	// written "off"
+	// 0
+}
+
+// Write a long value in two parts, which are written once executed.
+func ExampleServer_ProcessRequest_prepareWrite() {
+	s := newExampleServer()
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.PrepareWriteRequestCode, 0x08, 0x00, 0x00, 0x00, 'l', 'o', 'n'}))
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.PrepareWriteRequestCode, 0x08, 0x00, 0x03, 0x00, 'g'}))
+	fmt.Printf("% X\n", s.ProcessRequest([]byte{att.ExecuteWriteRequestCode, 0x01}))
+	// Output:
+	// 17 08 00 00 00 6C 6F 6E
+	// 17 08 00 03 00 67
+	// written "long"
+	// 19
+}
+
+// Requests of an invalid handle are responded with an Error Response.
+func ExampleServer_ProcessRequest_error() {
+	s := newExampleServer()
+	op, h, err, _ := att.ParseErrorResponse(s.ProcessRequest([]byte{att.ReadRequestCode, 0x10, 0x00}))
+	fmt.Printf("0x%02X 0x%04X %v\n", op, h, err)
+	// Output:
+	// 0x0A 0x0010 invalid handle
+}
@@ -0,0 +1,74 @@
+package att
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/currantlabs/ble"
+)
+
+// cidATT is the L2CAP channel ID of the Attribute Protocol. [Vol 3, Part A, 2.1]
+const cidATT = 0x0004
+
+// NewFramedConn returns a ble.Conn, which carries ATT PDUs as L2CAP basic
+// frames over c, a stream-oriented connection. [Vol 3, Part A, 3.1]
+//
+// The returned Conn reads the L2CAP header (length + channel ID), and returns
+// exactly one ATT PDU for each Read. Frames of other channels, and empty
+// frames are discarded. A PDU longer than the buffer of the Read fills it up,
+// and the rest of it is discarded, so the Server rejects it as oversized.
+// Each Write is sent as a single frame. It's only needed by transports that
+// don't preserve the packet boundaries, such as a serial bridge.
+func NewFramedConn(c ble.Conn) ble.Conn {
+	return &framedConn{Conn: c, r: bufio.NewReader(c)}
+}
+
+type framedConn struct {
+	ble.Conn
+	r *bufio.Reader
+}
+
+func (c *framedConn) Read(b []byte) (int, error) {
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+			return 0, err
+		}
+		n := int(binary.LittleEndian.Uint16(hdr[0:2]))
+		cid := binary.LittleEndian.Uint16(hdr[2:4])
+		// Empty frames carry no PDU, and are skipped, as a Read returning
+		// nothing would be taken for the end of the connection.
+		if cid != cidATT || n == 0 {
+			if _, err := io.CopyN(ioutil.Discard, c.r, int64(n)); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if n <= len(b) {
+			return io.ReadFull(c.r, b[:n])
+		}
+		// Deliver the part of an oversized PDU, which fits in b, so it's
+		// rejected by the reader, and discard the rest of it.
+		logger.Error("framer", "read", fmt.Sprintf("truncated PDU of %d bytes", n))
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, c.r, int64(n-len(b))); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+}
+
+func (c *framedConn) Write(b []byte) (int, error) {
+	f := make([]byte, 4, 4+len(b))
+	binary.LittleEndian.PutUint16(f[0:2], uint16(len(b)))
+	binary.LittleEndian.PutUint16(f[2:4], cidATT)
+	if _, err := c.Conn.Write(append(f, b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,54 @@
+package att
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+// streamConn is a testConn, which reads from a byte stream.
+type streamConn struct {
+	*testConn
+	r io.Reader
+}
+
+func (c *streamConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// frame returns b in an L2CAP basic frame of channel cid.
+func frame(cid uint16, b []byte) []byte {
+	return pdu(uint16(len(b)), cid, b)
+}
+
+func TestFramedConn(t *testing.T) {
+	oversized := pdu(WriteRequestCode, uint16(0x0005), make([]byte, 27))
+	r, w := io.Pipe()
+	go func() {
+		w.Write(frame(0x0005, []byte{0x01, 0x02})) // LE signaling channel
+		w.Write(frame(cidATT, nil))
+		w.Write(frame(cidATT, pdu(ReadRequestCode, uint16(0x0003))))
+		w.Write(frame(cidATT, oversized))
+		w.Write(frame(cidATT, pdu(ReadRequestCode, uint16(0x0009))))
+	}()
+	c := &streamConn{testConn: newTestConn(ble.DefaultMTU), r: r}
+	s, err := NewServer(NewDB(testServices(), 1), NewFramedConn(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Loop()
+	defer func() {
+		w.Close()
+		c.Close()
+	}()
+
+	for _, want := range [][]byte{
+		frame(cidATT, pdu(ReadResponseCode, "Gopher")),
+		frame(cidATT, newErrorResponse(WriteRequestCode, 0x0000, ble.ErrInvalidPDU)),
+		frame(cidATT, pdu(ReadResponseCode, 99)),
+	} {
+		if b := c.recv(t); !bytes.Equal(b, want) {
+			t.Errorf("sent % X, want % X", b, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package att
+
+// NotificationPDU builds a Handle Value Notification. [Vol 3, Part F, 3.4.7.1]
+type NotificationPDU struct {
+	handle uint16
+	value  []byte
+}
+
+// SetHandle sets the handle of the attribute notified.
+func (p *NotificationPDU) SetHandle(h uint16) { p.handle = h }
+
+// SetValue sets the value of the attribute notified. It's not copied until Bytes is called.
+func (p *NotificationPDU) SetValue(v []byte) { p.value = v }
+
+// Bytes returns the PDU, or ErrValueTooLong if the value doesn't fit in a
+// single PDU for the ATT_MTU mtu.
+func (p *NotificationPDU) Bytes(mtu int) ([]byte, error) {
+	return valuePDU(HandleValueNotificationCode, p.handle, p.value, mtu)
+}
+
+// IndicationPDU builds a Handle Value Indication. [Vol 3, Part F, 3.4.7.2]
+type IndicationPDU struct {
+	handle uint16
+	value  []byte
+}
+
+// SetHandle sets the handle of the attribute indicated.
+func (p *IndicationPDU) SetHandle(h uint16) { p.handle = h }
+
+// SetValue sets the value of the attribute indicated. It's not copied until Bytes is called.
+func (p *IndicationPDU) SetValue(v []byte) { p.value = v }
+
+// Bytes returns the PDU, or ErrValueTooLong if the value doesn't fit in a
+// single PDU for the ATT_MTU mtu.
+func (p *IndicationPDU) Bytes(mtu int) ([]byte, error) {
+	return valuePDU(HandleValueIndicationCode, p.handle, p.value, mtu)
+}
+
+// valuePDU returns a Handle Value Notification or Indication of opcode op.
+func valuePDU(op byte, h uint16, v []byte, mtu int) ([]byte, error) {
+	if mtu < 3 || len(v) > MaxNotifyPayload(mtu) {
+		return nil, ErrValueTooLong
+	}
+	b := make([]byte, 3+len(v))
+	b[0] = op
+	HandleValueNotification(b).SetAttributeHandle(h)
+	copy(b[3:], v)
+	return b, nil
+}
+
+// ParseNotification decodes a Handle Value Notification PDU.
+// It returns false if b is not a well-formed notification.
+// The value returned shares the underlying array of b.
+func ParseNotification(b []byte) (handle uint16, value []byte, ok bool) {
+	r, err := NewHandleValueNotification(b)
+	if err != nil {
+		return 0, nil, false
+	}
+	return r.AttributeHandle(), r.AttributeValue(), true
+}
+
+// ParseIndication decodes a Handle Value Indication PDU.
+// It returns false if b is not a well-formed indication.
+// The value returned shares the underlying array of b.
+func ParseIndication(b []byte) (handle uint16, value []byte, ok bool) {
+	r, err := NewHandleValueIndication(b)
+	if err != nil {
+		return 0, nil, false
+	}
+	return r.AttributeHandle(), r.AttributeValue(), true
+}
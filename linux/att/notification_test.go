@@ -0,0 +1,91 @@
+package att
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestNotificationPDU(t *testing.T) {
+	long := bytes.Repeat([]byte{0xAA}, ble.DefaultMTU-3)
+	for _, tc := range []struct {
+		name  string
+		h     uint16
+		v     []byte
+		mtu   int
+		build func(h uint16, v []byte, mtu int) ([]byte, error)
+		parse func(b []byte) (uint16, []byte, bool)
+		other func(b []byte) (uint16, []byte, bool)
+	}{
+		{"notification", 0x1234, []byte{0x01, 0x02, 0x03}, 6, buildNotification, ParseNotification, ParseIndication},
+		{"empty notification", 0x0001, nil, 3, buildNotification, ParseNotification, ParseIndication},
+		{"full notification", 0xFFFF, long, ble.DefaultMTU, buildNotification, ParseNotification, ParseIndication},
+		{"indication", 0x1234, []byte{0x01, 0x02, 0x03}, 6, buildIndication, ParseIndication, ParseNotification},
+		{"empty indication", 0x0001, nil, 3, buildIndication, ParseIndication, ParseNotification},
+		{"full indication", 0xFFFF, long, ble.DefaultMTU, buildIndication, ParseIndication, ParseNotification},
+	} {
+		b, err := tc.build(tc.h, tc.v, tc.mtu)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(b) != 3+len(tc.v) {
+			t.Errorf("%s: PDU of %d bytes, want %d", tc.name, len(b), 3+len(tc.v))
+		}
+		h, v, ok := tc.parse(b)
+		if !ok || h != tc.h || !bytes.Equal(v, tc.v) {
+			t.Errorf("%s: parsed 0x%04X [% X] %t, want 0x%04X [% X]", tc.name, h, v, ok, tc.h, tc.v)
+		}
+		if _, _, ok := tc.other(b); ok {
+			t.Errorf("%s: parsed as the other PDU", tc.name)
+		}
+		// Each value fills the ATT_MTU, so one more byte doesn't fit.
+		if _, err := tc.build(tc.h, append(tc.v, 0x00), tc.mtu); err != ErrValueTooLong {
+			t.Errorf("%s: one more byte: got %v, want ErrValueTooLong", tc.name, err)
+		}
+	}
+
+	// The value is copied by Bytes.
+	v := []byte{0x01}
+	b, _ := buildNotification(0x0003, v, ble.DefaultMTU)
+	v[0] = 0x02
+	if want := pdu(HandleValueNotificationCode, uint16(0x0003), 0x01); !bytes.Equal(b, want) {
+		t.Errorf("got [% X], want [% X]", b, want)
+	}
+	for _, mtu := range []int{0, 2} {
+		if _, err := buildNotification(0x0003, nil, mtu); err != ErrValueTooLong {
+			t.Errorf("ATT_MTU %d: got %v, want ErrValueTooLong", mtu, err)
+		}
+	}
+	for _, b := range [][]byte{nil, {HandleValueNotificationCode}, {HandleValueNotificationCode, 0x03}} {
+		if _, _, ok := ParseNotification(b); ok {
+			t.Errorf("parsed [% X]", b)
+		}
+	}
+}
+
+// TestParseNotificationServed parses the notifications sent by a Server.
+func TestParseNotificationServed(t *testing.T) {
+	s, c := newTestServer(t, testServices())
+	if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, []byte{0x01, 0x02}); err != nil {
+		t.Fatal(err)
+	}
+	if h, v, ok := ParseNotification(c.recv(t)); !ok || h != 0x0005 || !bytes.Equal(v, []byte{0x01, 0x02}) {
+		t.Errorf("parsed 0x%04X [% X] %t, want 0x0005 [01 02]", h, v, ok)
+	}
+}
+
+func buildNotification(h uint16, v []byte, mtu int) ([]byte, error) {
+	var p NotificationPDU
+	p.SetHandle(h)
+	p.SetValue(v)
+	return p.Bytes(mtu)
+}
+
+func buildIndication(h uint16, v []byte, mtu int) ([]byte, error) {
+	var p IndicationPDU
+	p.SetHandle(h)
+	p.SetValue(v)
+	return p.Bytes(mtu)
+}
@@ -0,0 +1,155 @@
+package att
+
+import (
+	"time"
+
+	"github.com/currantlabs/ble"
+)
+
+// An Option is a configuration function, which configures the server.
+type Option func(*Server) error
+
+// OptIndicationTimeout sets the time to wait for the confirmation of an indication.
+// A zero duration waits until the indication is confirmed, or the connection is closed.
+func OptIndicationTimeout(d time.Duration) Option {
+	return func(s *Server) error {
+		if d < 0 {
+			return ErrInvalidArgument
+		}
+		s.IndicationTimeout = d
+		return nil
+	}
+}
+
+// OptAdvertisedRxMTU sets the Server Rx MTU advertised in the Exchange MTU Response.
+func OptAdvertisedRxMTU(mtu int) Option {
+	return func(s *Server) error {
+		if mtu < ble.DefaultMTU || mtu > s.rxMTU {
+			return ErrInvalidArgument
+		}
+		s.AdvertisedRxMTU = mtu
+		return nil
+	}
+}
+
+// OptExchangeMTUHandler sets the handler deciding the Server Rx MTU responded
+// to Exchange MTU Requests.
+func OptExchangeMTUHandler(f func(clientRxMTU int) (int, ble.ATTError)) Option {
+	return func(s *Server) error {
+		s.ExchangeMTUHandler = f
+		return nil
+	}
+}
+
+// OptRequestQueueSize sets the number of PDUs queued while a handler is running.
+func OptRequestQueueSize(n int) Option {
+	return func(s *Server) error {
+		if n < 0 {
+			return ErrInvalidArgument
+		}
+		s.RequestQueueSize = n
+		return nil
+	}
+}
+
+// OptOnMTUExchangeError sets the hook called when an Exchange MTU Request fails.
+func OptOnMTUExchangeError(f func(reason ble.ATTError)) Option {
+	return func(s *Server) error {
+		s.OnMTUExchangeError = f
+		return nil
+	}
+}
+
+// OptOnRead sets the hook called with the length of each PDU read from the connection.
+func OptOnRead(f func(n int, pdu []byte)) Option {
+	return func(s *Server) error {
+		s.OnRead = f
+		return nil
+	}
+}
+
+// OptSupportedFeatures sets the Server Supported Features provided along with the server.
+func OptSupportedFeatures(f ServerFeature) Option {
+	return func(s *Server) error {
+		s.Features = f
+		return nil
+	}
+}
+
+// OptClock sets the Clock providing the time to the server.
+func OptClock(c Clock) Option {
+	return func(s *Server) error {
+		s.Clock = c
+		return nil
+	}
+}
+
+// OptReadByTypePolicy sets the policy of responding Read By Type Requests.
+func OptReadByTypePolicy(p ReadByTypePolicy) Option {
+	return func(s *Server) error {
+		s.ReadByTypePolicy = p
+		return nil
+	}
+}
+
+// OptStrictNotify rejects notifications and indications the remote central hasn't subscribed to.
+func OptStrictNotify(strict bool) Option {
+	return func(s *Server) error {
+		s.StrictNotify = strict
+		return nil
+	}
+}
+
+// OptMaxErrorRate limits the number of Error Responses sent per second.
+func OptMaxErrorRate(n int) Option {
+	return func(s *Server) error {
+		if n < 0 {
+			return ErrInvalidArgument
+		}
+		s.MaxErrorRate = n
+		return nil
+	}
+}
+
+// OptMaxEntriesPerResponse limits the number of entries in each discovery response.
+func OptMaxEntriesPerResponse(n int) Option {
+	return func(s *Server) error {
+		if n < 0 {
+			return ErrInvalidArgument
+		}
+		s.MaxEntriesPerResponse = n
+		return nil
+	}
+}
+
+// OptCCCDStore sets the store persisting Client Characteristic Configurations.
+func OptCCCDStore(st CCCDStore) Option {
+	return func(s *Server) error {
+		s.CCCDStore = st
+		return nil
+	}
+}
+
+// OptDefaultReadHandler sets the handler for attributes without a ReadHandler.
+func OptDefaultReadHandler(h func(h uint16, req ble.Request, rsp ble.ResponseWriter)) Option {
+	return func(s *Server) error {
+		s.DefaultReadHandler = h
+		return nil
+	}
+}
+
+// OptOnWriteCommand sets the hook called after each Write Command is handled.
+func OptOnWriteCommand(f func(handle uint16, value []byte, err ble.ATTError)) Option {
+	return func(s *Server) error {
+		s.OnWriteCommand = f
+		return nil
+	}
+}
+
+// OptOnWriteComplete sets the hook called after each Write Request succeeds.
+func OptOnWriteComplete(f func(conn ble.Conn, handle uint16, value []byte)) Option {
+	return func(s *Server) error {
+		s.OnWriteComplete = f
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+package att
+
+import "github.com/currantlabs/ble"
+
+// Flag bits of the Attribute Opcode. [Vol 3, Part F, 3.3.1]
+const (
+	cmdFlag = 0x40 // Command Flag
+	sigFlag = 0x80 // Authentication Signature Flag
+)
+
+// pduLen is the range of valid length of a PDU, including the opcode.
+type pduLen struct {
+	min int
+	max int // 0 means the length is bounded by the ATT_MTU only.
+
+	// uuid is set for PDUs that end with a UUID, which is either 2 or 16 bytes.
+	// In which case, the length must be either min or max.
+	uuid bool
+}
+
+// reqLen lists the valid lengths of request and command PDUs.
+// Refer to the PDU definitions in [Vol 3, Part F, 3.4].
+var reqLen = map[byte]pduLen{
+	ExchangeMTURequestCode:      {min: 3, max: 3},
+	FindInformationRequestCode:  {min: 5, max: 5},
+	FindByTypeValueRequestCode:  {min: 8}, // A value is required; there is nothing to match otherwise.
+	ReadByTypeRequestCode:       {min: 7, max: 21, uuid: true},
+	ReadRequestCode:             {min: 3, max: 3},
+	ReadBlobRequestCode:         {min: 5, max: 5},
+	ReadMultipleRequestCode:     {min: 5},
+	ReadByGroupTypeRequestCode:  {min: 7, max: 21, uuid: true},
+	WriteRequestCode:            {min: 3},
+	WriteCommandCode:            {min: 3},
+	PrepareWriteRequestCode:     {min: 5},
+	ExecuteWriteRequestCode:     {min: 2, max: 2},
+	SignedWriteCommandCode:      {min: 15},
+	HandleValueConfirmationCode: {min: 1, max: 1},
+}
+
+// validateLength checks the length of PDU b against the spec of opcode op.
+// It returns ErrInvalidPDU for malformed lengths, and ErrSuccess otherwise.
+// Unknown opcodes are left to the dispatcher, and reported as ErrSuccess.
+func validateLength(op byte, b []byte) ble.ATTError {
+	l, ok := reqLen[op]
+	if !ok {
+		return ble.ErrSuccess
+	}
+	switch n := len(b); {
+	case l.uuid && n != l.min && n != l.max:
+		return ble.ErrInvalidPDU
+	case n < l.min:
+		return ble.ErrInvalidPDU
+	case l.max != 0 && n > l.max:
+		return ble.ErrInvalidPDU
+	}
+	return ble.ErrSuccess
+}
+
+// ParseErrorResponse decodes an Error Response PDU. [Vol 3, Part F, 3.4.1.1]
+// It returns false if b is not a well-formed Error Response, or if it carries
+// the reserved error code 0x00.
+func ParseErrorResponse(b []byte) (reqOpcode byte, handle uint16, err ble.ATTError, ok bool) {
+	r, e := NewErrorResponse(b)
+	if e != nil || r.ErrorCode() == 0 {
+		return 0, 0, 0, false
+	}
+	return r.RequestOpcodeInError(), r.AttributeInError(), ble.ATTError(r.ErrorCode()), true
+}
+
+// ErrorFrom returns the error code carried by b, if b is an Error Response.
+// Otherwise, it returns nil.
+func ErrorFrom(b []byte) error {
+	if _, _, err, ok := ParseErrorResponse(b); ok {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package att
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestValidateLength(t *testing.T) {
+	// The boundaries are spelled out against the PDU definitions, rather
+	// than derived from reqLen. [Vol 3, Part F, 3.4]
+	for _, tc := range []struct {
+		op      byte
+		valid   []int
+		invalid []int
+	}{
+		{ExchangeMTURequestCode, []int{3}, []int{1, 2, 4}},
+		{FindInformationRequestCode, []int{5}, []int{4, 6}},
+		{FindByTypeValueRequestCode, []int{8, 9, 512}, []int{1, 7}},
+		{ReadByTypeRequestCode, []int{7, 21}, []int{6, 8, 20, 22}},
+		{ReadRequestCode, []int{3}, []int{2, 4}},
+		{ReadBlobRequestCode, []int{5}, []int{4, 6}},
+		{ReadMultipleRequestCode, []int{5, 7, 512}, []int{3, 4}},
+		{ReadByGroupTypeRequestCode, []int{7, 21}, []int{6, 8, 20, 22}},
+		{WriteRequestCode, []int{3, 4, 512}, []int{1, 2}},
+		{WriteCommandCode, []int{3, 4, 512}, []int{1, 2}},
+		{PrepareWriteRequestCode, []int{5, 6, 512}, []int{3, 4}},
+		{ExecuteWriteRequestCode, []int{2}, []int{1, 3}},
+		{SignedWriteCommandCode, []int{15, 16, 512}, []int{3, 14}},
+		{HandleValueConfirmationCode, []int{1}, []int{2}},
+	} {
+		for _, n := range tc.valid {
+			if e := validateLength(tc.op, make([]byte, n)); e != ble.ErrSuccess {
+				t.Errorf("opcode 0x%02X, length %d: got %v, want success", tc.op, n, e)
+			}
+		}
+		for _, n := range tc.invalid {
+			if e := validateLength(tc.op, make([]byte, n)); e != ble.ErrInvalidPDU {
+				t.Errorf("opcode 0x%02X, length %d: got %v, want %v", tc.op, n, e, ble.ErrInvalidPDU)
+			}
+		}
+	}
+
+	// Unknown opcodes are left to the dispatcher.
+	if e := validateLength(0x3F, make([]byte, 1)); e != ble.ErrSuccess {
+		t.Errorf("unknown opcode: got %v, want success", e)
+	}
+}
+
+func TestErrorFrom(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		b    []byte
+		want error
+	}{
+		{"error response", []byte{ErrorResponseCode, ReadRequestCode, 0x03, 0x00, byte(ble.ErrReadNotPerm)}, ble.ErrReadNotPerm},
+		{"read response", []byte{ReadResponseCode, byte(ble.ErrReadNotPerm)}, nil},
+		{"short", []byte{ErrorResponseCode, ReadRequestCode, 0x03, 0x00}, nil},
+		{"long", []byte{ErrorResponseCode, ReadRequestCode, 0x03, 0x00, byte(ble.ErrReadNotPerm), 0x00}, nil},
+		{"reserved code", []byte{ErrorResponseCode, ReadRequestCode, 0x03, 0x00, 0x00}, nil},
+	} {
+		if got := ErrorFrom(tc.b); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestInvalidLengthResponse(t *testing.T) {
+	_, c := newTestServer(t, testServices())
+	for _, req := range [][]byte{
+		pdu(ReadRequestCode, uint16(0x0003), 0),
+		pdu(FindInformationRequestCode, uint16(0x0001)),
+		pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), 0x00, 0x28, 0),
+	} {
+		want := newErrorResponse(req[0], 0x0000, ble.ErrInvalidPDU)
+		if b := c.request(t, req); !bytes.Equal(b, want) {
+			t.Errorf("[% X]: got [% X], want [% X]", req, b, want)
+		}
+	}
+}
+
+// TestFindByTypeValueEmpty checks that a Find By Type Value Request without
+// any value to match is rejected, rather than matched against empty values.
+func TestFindByTypeValueEmpty(t *testing.T) {
+	_, c := newTestServer(t, testServices())
+	req := pdu(FindByTypeValueRequestCode, uint16(0x0001), uint16(0xFFFF), ble.PrimaryServiceUUID)
+	if len(req) != 7 {
+		t.Fatalf("request of %d bytes, want 7", len(req))
+	}
+	if b, want := c.request(t, req), newErrorResponse(FindByTypeValueRequestCode, 0x0000, ble.ErrInvalidPDU); !bytes.Equal(b, want) {
+		t.Errorf("empty value: got [% X], want [% X]", b, want)
+	}
+	// The same request with a value is served.
+	if b, want := c.request(t, pdu(req, ble.GAPUUID)), pdu(FindByTypeValueResponseCode, uint16(0x0001), uint16(0x0006)); !bytes.Equal(b, want) {
+		t.Errorf("GAP: got [% X], want [% X]", b, want)
+	}
+}
@@ -5,33 +5,280 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/currantlabs/ble"
+	"golang.org/x/net/context"
 )
 
 type conn struct {
 	ble.Conn
-	svr  *Server
+	svr *Server
+
+	// mu guards cccs and features, which may be accessed outside of the serving goroutine.
+	mu   sync.Mutex
 	cccs map[uint16]uint16
 	nn   map[uint16]ble.Notifier
 	in   map[uint16]ble.Notifier
+
+	// features are the Client Supported Features written by the client.
+	features byte
+}
+
+// ccc returns the Client Characteristic Configuration of the characteristic h.
+func (c *conn) ccc(h uint16) uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cccs[h]
 }
 
+// ReadByTypePolicy determines how a Read By Type Request is responded, when
+// one of the matching attributes can't be read, for example, due to security
+// requirements. An error reading the first matching attribute always fails
+// the request.
+type ReadByTypePolicy int
+
+const (
+	// ReadByTypePartial responds with the values preceding the one that
+	// can't be read. This is the behavior specified by [Vol 3, Part F, 3.4.4.1],
+	// and is the default.
+	ReadByTypePartial ReadByTypePolicy = iota
+
+	// ReadByTypeAllOrNothing fails the whole request with the error of the
+	// attribute that can't be read.
+	ReadByTypeAllOrNothing
+)
+
 // Server implementas an ATT (Attribute Protocol) server.
 type Server struct {
+	// dropped counts the requests dropped for the MaxErrorRate. It's accessed
+	// atomically, and kept first in the struct for 64-bit alignment.
+	dropped uint64
+
+	// errCounts counts the Error Responses by error code. They're accessed
+	// atomically, and kept next to dropped for 64-bit alignment.
+	errCounts [256]uint64
+
+	// IndicationTimeout is the time to wait for the confirmation of an
+	// indication. It defaults to 30 seconds. [Vol 3, Part F, 3.3.3]
+	// A zero IndicationTimeout disables the timeout; the indication then waits
+	// until it's confirmed, or the connection is closed, which returns
+	// io.ErrClosedPipe.
+	IndicationTimeout time.Duration
+
+	// ReadByTypePolicy determines how a Read By Type Request is responded,
+	// when a value other than the first one can't be read.
+	ReadByTypePolicy ReadByTypePolicy
+
+	// DefaultReadHandler, if set, handles reads of the attributes, which have
+	// neither a static value nor a ReadHandler, with the handle of the attribute.
+	// It allows serving values that aren't known in advance, e.g. a proxy of a
+	// remote device. Otherwise, such reads are responded with ErrInvalidHandle.
+	DefaultReadHandler func(h uint16, req ble.Request, rsp ble.ResponseWriter)
+
+	// HandlerConcurrency, if greater than 1, is the number of ReadHandlers
+	// invoked concurrently for a Read By Type or Find By Type Value Request,
+	// which visits multiple attributes. The response is still built in the
+	// order of handles, but the handlers must be safe for concurrent use, and
+	// may be invoked for attributes that turn out not to be included.
+	// By default, the handlers are invoked one by one.
+	HandlerConcurrency int
+
+	// Features is the mask of the Server Supported Features, which are
+	// provided along with the Server, e.g. EATT served on the enhanced credit
+	// based channels set up by the application. They're reported by
+	// SupportedFeatures in addition to the features the Server implements.
+	Features ServerFeature
+
+	// Clock, if set, provides the time to the Server in place of the system
+	// clock, for the timeouts and the rate limiting. It allows tests to
+	// trigger the timeouts deterministically.
+	Clock Clock
+
+	// AdvertisedRxMTU, if set, is the Server Rx MTU advertised in the Exchange
+	// MTU Response, in place of the RxMTU of the connection, which the receive
+	// buffers are still sized to. It allows being conservative on the wire,
+	// while tolerating oversized PDUs. It's ignored, unless it's in the range
+	// [DefaultMTU, RxMTU of the connection).
+	AdvertisedRxMTU int
+
+	// ResponseInterceptor, if set, is called with each PDU handled, and its
+	// response, which is nil for commands, before the response is sent. The
+	// response returned is sent instead, and nil suppresses it. It allows
+	// fault injection, or rewriting the responses, e.g. in a GATT proxy.
+	// Neither of the slices may be retained.
+	ResponseInterceptor func(req, rsp []byte) []byte
+
+	// OnRead, if set, is called by the Loop with the number of bytes n returned
+	// by each Read of the connection, and the PDU read, before it's handled.
+	// It's a diagnostic aid for transports splitting PDUs across reads, which
+	// the Loop doesn't reassemble; use NewFramedConn for those. An n beyond
+	// the RxMTU means the PDU is oversized, and is responded ErrInvalidPDU.
+	// It's called from the reading goroutine, and the PDU may not be retained.
+	OnRead func(n int, pdu []byte)
+
+	// OnMTUExchangeError, if set, is called with the error responded to an
+	// Exchange MTU Request, e.g. ErrInvalidPDU for a malformed one, after which
+	// the default ATT_MTU remains in use. It allows detecting the clients
+	// failing the negotiation.
+	OnMTUExchangeError func(reason ble.ATTError)
+
+	// ExchangeMTUHandler, if set, decides the Server Rx MTU responded to an
+	// Exchange MTU Request, in place of the local negotiation, e.g. to relay
+	// the Client Rx MTU to the upstream peripheral of a GATT proxy, and echo
+	// its response. It also allows custom policies; returning an error, e.g.
+	// ErrReqNotSupp to refuse a Client Rx MTU too large to afford, fails the
+	// request, and the default ATT_MTU remains in use. The returned value is
+	// capped at the RxMTU of the connection, which the receive buffers are
+	// sized to.
+	ExchangeMTUHandler func(clientRxMTU int) (serverRxMTU int, err ble.ATTError)
+
+	// RequestQueueSize is the number of PDUs received, which are queued while
+	// a handler is running. The PDUs are read by a goroutine separate from the
+	// one handling them, so the confirmations of indications are processed,
+	// and commands are drained, while a slow handler runs, until the queue is
+	// full. The PDUs are still handled, and responded, in the order received.
+	// RequestQueueSize must be set before the Loop starts.
+	RequestQueueSize int
+
+	// MaxEntriesPerResponse limits the number of entries in each Find
+	// Information, Read By Type, and Read By Group Type Response, below what
+	// the ATT_MTU can hold, so clients issue more requests to discover the
+	// rest. It's an interoperability aid for centrals, which can't handle
+	// responses packing many entries. Zero means no limit.
+	MaxEntriesPerResponse int
+
+	// StrictPrepareWrites requires the parts queued by Prepare Write Requests
+	// for each attribute to form a contiguous value from offset 0, without any
+	// gap or overlap, regardless of the order they were queued. Otherwise, the
+	// Execute Write Request fails with ErrInvalidOffset, and the attribute in
+	// error. By default, the parts are applied in the order they were queued.
+	StrictPrepareWrites bool
+
+	// StrictNotify rejects notifications and indications sent by NotifyByUUID
+	// or IndicateTimeout with ErrNotSubscribed, if the remote central hasn't
+	// enabled them in the CCCD of the characteristic. Those queued by
+	// NotifyAfterResponse are dropped. It catches producers running before the
+	// client subscribes. By default, they're sent regardless.
+	StrictNotify bool
+
+	// MaxErrorRate limits the number of Error Responses sent per second.
+	// Requests in error beyond the rate are dropped without being responded,
+	// to protect the server and the link from a flooding peer. Zero means no limit.
+	MaxErrorRate int
+
+	// CCCDStore, if set, persists the Client Characteristic Configurations
+	// written by the peer, and restores them when the Server starts serving.
+	CCCDStore CCCDStore
+
+	// AuditHook, if set, is called for each successful read or write of an
+	// attribute by Read, Read Blob, Read Multiple, Write, Write Command, and
+	// Execute Write Requests, with the value read or written. It's called
+	// before the response is sent, and must not retain the value.
+	// Discovery requests, such as Read By Type, are not audited.
+	AuditHook func(conn ble.Conn, opcode byte, handle uint16, value []byte)
+
+	// OnWriteCommand, if set, is called after each Write Command is handled,
+	// with the result of the upper layer handler. It's a local debugging aid;
+	// nothing is sent to the client, as commands have no response by spec.
+	OnWriteCommand func(handle uint16, value []byte, err ble.ATTError)
+
+	// OnWriteComplete, if set, is called after each Write Request is handled
+	// successfully by the upper layer, with the value written, before the Write
+	// Response is sent. It isn't called for failed writes, or Write Commands.
+	// It must not retain the value.
+	OnWriteComplete func(conn ble.Conn, handle uint16, value []byte)
+
 	conn *conn
+
+	// values is the application data scoped to the connection.
+	values Values
+
+	// dbMu guards db, which may be swapped while requests are being handled.
+	// Each request is handled against a single DB, either the old or new one.
+	dbMu sync.RWMutex
 	db   *DB
 
 	// Refer to [Vol 3, Part F, 3.3.2 & 3.3.3] for the requirement of
 	// sequential request-response protocol, and transactions.
-	rxMTU     int
-	txBuf     []byte
-	chNotBuf  chan []byte
-	chIndBuf  chan []byte
-	chConfirm chan bool
+	rxMTU    int
+	txBuf    []byte
+	chNotBuf chan []byte
+	chIndBuf chan []byte
+
+	// readDone is closed, once the connection has been read to its end.
+	readDone chan struct{}
+
+	// indMu guards the indication state. Confirmations are received in the
+	// order the indications are sent, so the indSent-th indication is
+	// confirmed by the indSent-th confirmation. indWait receives the
+	// confirmation of the indication in flight, whose number is indSeq, and
+	// indCancel cancels it. The confirmations of the cancelled or timed out
+	// indications are counted, and dropped.
+	indMu        sync.Mutex
+	indCancel    chan struct{}
+	indWait      chan struct{}
+	indSeq       uint64
+	indSent      uint64
+	indConfirmed uint64
+
+	// pendingMTU is the ATT_MTU to be applied after the Exchange MTU Response is sent.
+	pendingMTU int
+
+	// mtuExchanged is set, once the exchanged ATT_MTU has been applied.
+	mtuExchanged int32
+
+	// closed is set, once the connection is closed.
+	closed int32
+
+	// shuttingDown is set by Shutdown, after which no request is handled.
+	// serveMu is held while a request is handled, and responded.
+	shuttingDown int32
+	serveMu      sync.Mutex
 
 	dummyRspWriter ble.ResponseWriter
+
+	// cmdReq is reused for each Write Command.
+	cmdReq cmdRequest
+
+	// started is closed, once the Loop is ready to receive requests.
+	started chan struct{}
+
+	// rspTail is the remaining part of the response being handled, which is
+	// sent along with the response without being copied into the txBuf.
+	// It's only used if the underlying connection supports vectored IO.
+	rspTail []byte
+
+	lastErr atomic.Value
+
+	// errWindow and errCount track the Error Responses sent in the current
+	// second for the MaxErrorRate.
+	errWindow time.Time
+	errCount  int
+
+	// afterRsp is the notifications to be sent after the current response.
+	// It's guarded by afterMu, as the handlers prefetched for the response
+	// may run concurrently.
+	afterMu  sync.Mutex
+	afterRsp []notification
+
+	// prepared is the queue of Prepare Write Requests. [Vol 3, Part F, 3.4.6]
+	prepared []PreparedWrite
+
+	// disabled opcodes are responded with ErrReqNotSupp without being handled.
+	disabled [256]bool
+
+	// mtuGated opcodes are responded with the error until the MTU is exchanged.
+	mtuGated [256]ble.ATTError
+}
+
+// A Clock provides the current time, and timers.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
 }
 
 // NewServer returns an ATT (Attribute Protocol) server.
@@ -52,13 +299,16 @@ func NewServer(db *DB, l2c ble.Conn) (*Server, error) {
 		},
 		db: db,
 
-		rxMTU:     mtu,
-		txBuf:     make([]byte, ble.DefaultMTU, ble.DefaultMTU),
-		chNotBuf:  make(chan []byte, 1),
-		chIndBuf:  make(chan []byte, 1),
-		chConfirm: make(chan bool),
+		rxMTU:    mtu,
+		txBuf:    make([]byte, ble.DefaultMTU, ble.DefaultMTU),
+		chNotBuf: make(chan []byte, 1),
+		chIndBuf: make(chan []byte, 1),
+		readDone: make(chan struct{}),
 
 		dummyRspWriter: ble.NewResponseWriter(nil),
+		started:        make(chan struct{}),
+
+		IndicationTimeout: 30 * time.Second,
 	}
 	s.conn.svr = s
 	s.chNotBuf <- make([]byte, ble.DefaultMTU, ble.DefaultMTU)
@@ -66,7 +316,89 @@ func NewServer(db *DB, l2c ble.Conn) (*Server, error) {
 	return s, nil
 }
 
+// Serve returns an ATT server configured with the options, which has been
+// started serving requests on l2c in a goroutine.
+func Serve(l2c ble.Conn, db *DB, opts ...Option) (*Server, error) {
+	s, err := NewServer(db, l2c)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Option(opts...); err != nil {
+		return nil, err
+	}
+	go s.Loop()
+	return s, nil
+}
+
+// Option sets the options specified.
+// It should be called before the server starts serving requests.
+func (s *Server) Option(opts ...Option) error {
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDB replaces the attribute database served by s. Requests being handled
+// complete against the old database, and the following ones are handled
+// against db. SetDB must not be called from within a handler of s.
+//
+// Use ServiceChanged to inform the remote central of the change.
+func (s *Server) SetDB(db *DB) {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	s.db = db
+}
+
+// ServiceChanged indicates the remote central that the attributes within
+// the range [start, end] have been changed, if the central has subscribed
+// to the Service Changed characteristic. [Vol 3, Part G, 7.1]
+// ServiceChanged blocks until the indication is confirmed.
+func (s *Server) ServiceChanged(start, end uint16) error {
+	s.dbMu.RLock()
+	var vh uint16
+	for _, a := range s.db.subrange(0x0001, 0xFFFF) {
+		if a.typ.Equal(ble.ServiceChangedUUID) {
+			vh = a.h
+			break
+		}
+	}
+	s.dbMu.RUnlock()
+
+	// The value attribute immediately follows the characteristic declaration.
+	if vh == 0 || s.conn.ccc(vh-1)&cccIndicate == 0 {
+		return nil
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint16(b, start)
+	binary.LittleEndian.PutUint16(b[2:], end)
+	_, err := s.indicate(vh, b, s.IndicationTimeout)
+	return err
+}
+
+// connParamsUpdater is implemented by a ble.Conn, which supports the L2CAP
+// Connection Parameter Update procedure.
+type connParamsUpdater interface {
+	RequestConnectionParameterUpdate(p ble.ConnParams) error
+}
+
+// RequestConnectionParameterUpdate requests the remote central to update the
+// connection parameters. It returns nil if the central accepts the parameters.
+// It returns ErrUnsupported if the underlying connection doesn't support it.
+func (s *Server) RequestConnectionParameterUpdate(p ble.ConnParams) error {
+	u, ok := s.conn.Conn.(connParamsUpdater)
+	if !ok {
+		return ErrUnsupported
+	}
+	return u.RequestConnectionParameterUpdate(p)
+}
+
 // notify sends notification to remote central.
+// Each notification is written as its own L2CAP SDU, and is never coalesced
+// with others; the receiver expects exactly one ATT PDU per SDU. [Vol 3, Part F, 3.2]
+// It returns ErrServerClosed, once the Server or its connection is closed.
 func (s *Server) notify(h uint16, data []byte) (int, error) {
 	// Acquire and reuse notifyBuffer. Release it after usage.
 	nBuf := <-s.chNotBuf
@@ -81,11 +413,178 @@ func (s *Server) notify(h uint16, data []byte) (int, error) {
 		data = data[:buf.Cap()]
 	}
 	buf.Write(data)
-	return s.conn.Write(rsp[:3+buf.Len()])
+	if atomic.LoadInt32(&s.closed) != 0 {
+		return 0, ErrServerClosed
+	}
+	n, err := s.conn.Write(rsp[:3+buf.Len()])
+	if err != nil && atomic.LoadInt32(&s.closed) != 0 {
+		// Whatever the transport reports, the connection has been closed.
+		return n, ErrServerClosed
+	}
+	return n, err
+}
+
+// NotifyByUUID sends a notification, or an indication if ind is true, of the
+// value of the characteristic u, without the caller knowing its value handle.
+// If multiple characteristics share the same UUID, the first one is used.
+// It returns ErrAttrNotFound if the characteristic doesn't exist, or
+// ErrInvalidHandle if it doesn't support notifications or indications.
+// With StrictNotify, it returns ErrNotSubscribed if the remote central hasn't
+// enabled them.
+func (s *Server) NotifyByUUID(ind bool, u ble.UUID, data []byte) (int, error) {
+	s.dbMu.RLock()
+	var prop ble.Property
+	var vh uint16
+	for _, a := range s.db.subrangeOfType(ble.CharacteristicUUID, 0x0001, 0xFFFF) {
+		if p, h, cu, ok := ParseCharacteristicDeclaration(a.v); ok && cu.Equal(u) {
+			prop, vh = p, h
+			break
+		}
+	}
+	s.dbMu.RUnlock()
+
+	switch {
+	case vh == 0:
+		return 0, ble.ErrAttrNotFound
+	case ind && prop&ble.CharIndicate == 0, !ind && prop&ble.CharNotify == 0:
+		return 0, ble.ErrInvalidHandle
+	case s.StrictNotify && !s.subscribed(vh, ind):
+		return 0, ErrNotSubscribed
+	case ind:
+		return s.indicate(vh, data, s.IndicationTimeout)
+	}
+	return s.notify(vh, data)
+}
+
+// A Scope restricts the notifications and indications sent through it to the
+// characteristics in a range of handles, e.g. the service owned by a module,
+// when multiple modules share a Server. It catches modules notifying handles
+// of others by mistake.
+type Scope struct {
+	s          *Server
+	start, end uint16
+}
+
+// Scope returns a Scope of the handles in range [start, end]. For example,
+// the range of a service is [Service.Handle, Service.EndHandle], once it's
+// added to a DB.
+func (s *Server) Scope(start, end uint16) *Scope {
+	return &Scope{s: s, start: start, end: end}
+}
+
+// Notify sends a notification of the characteristic value vh with data.
+// It returns ErrInvalidHandle if vh is out of the scope, or the characteristic
+// doesn't support notifications.
+func (sc *Scope) Notify(vh uint16, data []byte) (int, error) {
+	if !sc.supports(vh, ble.CharNotify) {
+		return 0, ble.ErrInvalidHandle
+	}
+	if sc.s.StrictNotify && !sc.s.subscribed(vh, false) {
+		return 0, ErrNotSubscribed
+	}
+	return sc.s.notify(vh, data)
+}
+
+// Indicate sends an indication of the characteristic value vh with data, and
+// waits for the confirmation up to the IndicationTimeout.
+// It returns ErrInvalidHandle if vh is out of the scope, or the characteristic
+// doesn't support indications.
+func (sc *Scope) Indicate(vh uint16, data []byte) (int, error) {
+	if !sc.supports(vh, ble.CharIndicate) {
+		return 0, ble.ErrInvalidHandle
+	}
+	if sc.s.StrictNotify && !sc.s.subscribed(vh, true) {
+		return 0, ErrNotSubscribed
+	}
+	return sc.s.indicate(vh, data, sc.s.IndicationTimeout)
+}
+
+// supports reports whether the characteristic value vh is in the scope, and
+// has the property p.
+func (sc *Scope) supports(vh uint16, p ble.Property) bool {
+	if vh < sc.start || vh > sc.end {
+		return false
+	}
+	sc.s.dbMu.RLock()
+	defer sc.s.dbMu.RUnlock()
+	for _, a := range sc.s.db.subrangeOfType(ble.CharacteristicUUID, sc.start, vh) {
+		if prop, h, _, ok := ParseCharacteristicDeclaration(a.v); ok && h == vh {
+			return prop&p != 0
+		}
+	}
+	return false
+}
+
+type notification struct {
+	h    uint16
+	data []byte
+}
+
+// NotifyAfterResponse sends a notification of attribute h with data, after the
+// response to the request being handled has been sent. It's meant to be called
+// from within the ReadHandlers or WriteHandlers of s, including the ones invoked
+// concurrently for the HandlerConcurrency. Notifiers can be used anywhere else.
+func (s *Server) NotifyAfterResponse(h uint16, data []byte) {
+	s.afterMu.Lock()
+	defer s.afterMu.Unlock()
+	s.afterRsp = append(s.afterRsp, notification{h: h, data: append([]byte{}, data...)})
+}
+
+// RespondThenNotify is NotifyAfterResponse for the handlers, which don't
+// have the Server at hand. Called from a WriteHandler, the notification of
+// attribute h with data is sent right after the Write Response, before any
+// other request is handled, e.g. to acknowledge a write to a control point.
+// It returns ErrInvalidArgument, if req is not passed by a Server.
+func RespondThenNotify(req ble.Request, h uint16, data []byte) error {
+	cn, ok := req.Conn().(*conn)
+	if !ok {
+		return ErrInvalidArgument
+	}
+	cn.svr.NotifyAfterResponse(h, data)
+	return nil
 }
 
-// indicate sends indication to remote central.
-func (s *Server) indicate(h uint16, data []byte) (int, error) {
+// IndicateTimeout sends an indication of attribute h with data to the remote
+// central, and waits up to timeout for the confirmation, overriding the
+// IndicationTimeout of s for this indication only. A zero timeout waits
+// until the confirmation is received, or the connection is closed.
+// It returns ErrSeqProtoTimeout if the indication is not confirmed in time.
+func (s *Server) IndicateTimeout(h uint16, data []byte, timeout time.Duration) (int, error) {
+	if timeout < 0 {
+		return 0, ErrInvalidArgument
+	}
+	if s.StrictNotify && !s.subscribed(h, true) {
+		return 0, ErrNotSubscribed
+	}
+	return s.indicate(h, data, timeout)
+}
+
+// subscribed reports whether the remote central has enabled the indications,
+// if ind is true, or the notifications of the characteristic value vh.
+func (s *Server) subscribed(vh uint16, ind bool) bool {
+	bit := uint16(cccNotify)
+	if ind {
+		bit = cccIndicate
+	}
+	return s.cccOf(vh)&bit != 0
+}
+
+// cccOf returns the Client Characteristic Configuration of the characteristic
+// value vh, or 0 if there is no such characteristic.
+func (s *Server) cccOf(vh uint16) uint16 {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	for _, a := range s.db.subrangeOfType(ble.CharacteristicUUID, 0x0001, vh) {
+		if _, h, _, ok := ParseCharacteristicDeclaration(a.v); ok && h == vh {
+			return s.conn.ccc(a.h)
+		}
+	}
+	return 0
+}
+
+// indicate sends indication to remote central, and waits up to timeout for
+// the confirmation. A zero timeout waits without a deadline.
+func (s *Server) indicate(h uint16, data []byte, timeout time.Duration) (int, error) {
 	// Acquire and reuse indicateBuffer. Release it after usage.
 	iBuf := <-s.chIndBuf
 	defer func() { s.chIndBuf <- iBuf }()
@@ -99,46 +598,147 @@ func (s *Server) indicate(h uint16, data []byte) (int, error) {
 		data = data[:buf.Cap()]
 	}
 	buf.Write(data)
+	cancel := make(chan struct{})
+	wait := make(chan struct{}, 1)
+	s.indMu.Lock()
+	s.indSent++
+	s.indSeq = s.indSent
+	s.indCancel = cancel
+	s.indWait = wait
+	s.indMu.Unlock()
+	defer func() {
+		s.indMu.Lock()
+		if s.indCancel == cancel {
+			s.indCancel = nil
+			s.indWait = nil
+		}
+		s.indMu.Unlock()
+	}()
+
 	n, err := s.conn.Write(rsp[:3+buf.Len()])
 	if err != nil {
+		// No confirmation is expected for an indication not sent.
+		s.indMu.Lock()
+		s.indSent--
+		s.indMu.Unlock()
 		return n, err
 	}
+	var expired <-chan time.Time
+	switch {
+	case timeout > 0 && s.Clock != nil:
+		expired = s.Clock.After(timeout)
+	case timeout > 0:
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
 	select {
-	case _, ok := <-s.chConfirm:
-		if !ok {
-			return 0, io.ErrClosedPipe
-		}
+	case <-wait:
 		return n, nil
-	case <-time.After(time.Second * 30):
+	case <-s.readDone:
+		return 0, io.ErrClosedPipe
+	case <-expired:
 		return 0, ErrSeqProtoTimeout
+	case <-cancel:
+		return 0, ErrIndicationCancelled
+	}
+}
+
+// Flush blocks until the notification being written, if any, has been
+// written, and the indication in flight, if any, has been confirmed or timed
+// out, or ctx is done, in which case it returns the error of ctx. It gives
+// the upper layer a synchronization point after a burst of notifications.
+// The notifications queued by NotifyAfterResponse are sent by the Loop, and
+// not waited for. Flush is safe to be called from any goroutine.
+func (s *Server) Flush(ctx context.Context) error {
+	for _, ch := range []chan []byte{s.chNotBuf, s.chIndBuf} {
+		select {
+		case b := <-ch:
+			ch <- b
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// CancelIndication stops waiting for the confirmation of the indication in
+// flight, if any, which returns ErrIndicationCancelled. The confirmation
+// received later for the cancelled indication is dropped, and isn't taken
+// for the confirmation of the following indications.
+// CancelIndication is safe to be called from any goroutine.
+func (s *Server) CancelIndication() {
+	s.indMu.Lock()
+	defer s.indMu.Unlock()
+	if s.indCancel == nil {
+		return
 	}
+	close(s.indCancel)
+	s.indCancel = nil
+	s.indWait = nil
+}
+
+// confirm matches a received confirmation with the indication it confirms,
+// and releases the indication, if it's still waiting. It returns false, if
+// no indication is waiting for a confirmation.
+func (s *Server) confirm() bool {
+	s.indMu.Lock()
+	defer s.indMu.Unlock()
+	if s.indConfirmed == s.indSent {
+		return false
+	}
+	s.indConfirmed++
+	if s.indWait != nil && s.indConfirmed == s.indSeq {
+		s.indWait <- struct{}{}
+		s.indWait = nil
+	} else {
+		logger.Debug("server", "confirm", "dropped the confirmation of a cancelled indication")
+	}
+	return true
 }
 
 // Loop accepts incoming ATT request, and respond response.
 func (s *Server) Loop() {
+	s.restoreCCCs()
+	register(s)
+	defer deregister(s)
+	defer s.values.clear()
+
 	type sbuf struct {
 		buf []byte
 		len int
 	}
-	pool := make(chan *sbuf, 2)
-	pool <- &sbuf{buf: make([]byte, s.rxMTU)}
-	pool <- &sbuf{buf: make([]byte, s.rxMTU)}
+	// One buffer is being read into, and another one is being handled, in
+	// addition to the ones queued for the RequestQueueSize.
+	qlen := 0
+	if s.RequestQueueSize > 0 {
+		qlen = s.RequestQueueSize
+	}
+	pool := make(chan *sbuf, 2+qlen)
+	for i := 0; i < 2+qlen; i++ {
+		// One extra byte is allocated to detect PDUs longer than the rxMTU,
+		// which would have been truncated otherwise.
+		pool <- &sbuf{buf: make([]byte, s.rxMTU+1)}
+	}
 
-	seq := make(chan *sbuf)
+	seq := make(chan *sbuf, qlen)
 	go func() {
 		b := <-pool
+		close(s.started)
 		for {
 			n, err := s.conn.Read(b.buf)
+			if s.OnRead != nil && n != 0 {
+				s.OnRead(n, b.buf[:n])
+			}
 			if n == 0 || err != nil {
 				close(seq)
-				close(s.chConfirm)
+				close(s.readDone)
+				atomic.StoreInt32(&s.closed, 1)
 				_ = s.conn.Close()
 				return
 			}
 			if b.buf[0] == HandleValueConfirmationCode {
-				select {
-				case s.chConfirm <- true:
-				default:
+				if !s.confirm() {
 					logger.Error("server", "recieved a spurious confirmation", nil)
 				}
 				continue
@@ -149,13 +749,26 @@ func (s *Server) Loop() {
 		}
 	}()
 	for req := range seq {
-		if rsp := s.handleRequest(req.buf[:req.len]); rsp != nil {
-			if len(rsp) != 0 {
-				s.conn.Write(rsp)
-			}
+		s.serveMu.Lock()
+		if atomic.LoadInt32(&s.shuttingDown) != 0 {
+			// Drop the requests received during the shutdown.
+			s.serveMu.Unlock()
+			pool <- req
+			continue
+		}
+		rsp := s.handleRequest(req.buf[:req.len])
+		if s.ResponseInterceptor != nil {
+			rsp = s.intercept(req.buf[:req.len], rsp)
+		}
+		if len(rsp) != 0 {
+			s.send(rsp)
 		}
+		s.afterResponse()
+		s.serveMu.Unlock()
 		pool <- req
 	}
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
 	for h, ccc := range s.conn.cccs {
 		if ccc != 0 {
 			logger.Info("cleanup", "ccc", fmt.Sprintf("0x%02X", ccc))
@@ -169,9 +782,231 @@ func (s *Server) Loop() {
 	}
 }
 
+// Close closes the connection, which ends the Loop. The notifications sent
+// afterwards, or being sent meanwhile, fail with ErrServerClosed.
+// Close is safe to be called from any goroutine.
+func (s *Server) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	s.values.clear()
+	return s.conn.Close()
+}
+
+// Values returns the application data scoped to the connection of s.
+// Handlers reach it with ValuesOf the connection of the request.
+func (s *Server) Values() *Values {
+	return &s.values
+}
+
+// Shutdown stops handling requests, waits for the one being handled, if any,
+// to be responded, and then closes the connection, so the client never sees
+// a partial response. If ctx is done first, the connection is closed
+// immediately, and the error of ctx is returned.
+// Shutdown is safe to be called from any goroutine.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	idle := make(chan struct{})
+	go func() {
+		s.serveMu.Lock()
+		defer s.serveMu.Unlock()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return s.Close()
+	case <-ctx.Done():
+		s.Close()
+		return ctx.Err()
+	}
+}
+
+// DisableOpcode disables the handling of requests or commands of opcode op.
+// Disabled requests are responded with ErrReqNotSupp, and disabled commands
+// are silently discarded, without consulting the upper layer.
+// For example, a read-only device may disable WriteRequestCode, WriteCommandCode,
+// PrepareWriteRequestCode, and SignedWriteCommandCode.
+// DisableOpcode must be called before the Loop starts.
+func (s *Server) DisableOpcode(op byte) {
+	s.disabled[op] = true
+}
+
+// ClientSupports reports whether the client has enabled the feature f by
+// writing the Client Supported Features characteristic, which is served by
+// ClientSupportedFeaturesCharacteristic. Features relying on the optional
+// PDUs, such as Multiple Handle Value Notifications, should consult it before
+// using them. ClientSupports is safe to be called from any goroutine.
+func (s *Server) ClientSupports(f Feature) bool {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	return s.conn.features&byte(f) != 0
+}
+
+// SupportedFeatures returns the features the Server implements, along with
+// the Features provided by the application, which is the single source of
+// the value of the Server Supported Features characteristic. EATT, the only
+// feature defined, needs the L2CAP enhanced credit based channels, which the
+// Server doesn't implement, so it's only reported if it's set in Features.
+func (s *Server) SupportedFeatures() ServerFeature {
+	return s.Features
+}
+
+// RequireMTUExchange gates the handling of requests or commands of opcode op
+// until the ATT_MTU has been exchanged, as some profiles require. Gated
+// requests are responded with e, e.g. ErrInsuffResources, and gated commands
+// are silently discarded. An e of ErrSuccess removes the gate.
+// RequireMTUExchange must be called before the Loop starts.
+func (s *Server) RequireMTUExchange(op byte, e ble.ATTError) {
+	s.mtuGated[op] = e
+}
+
+// vectorWriter is implemented by a ble.Conn, which supports vectored IO.
+// WriteBuffers sends the concatenation of v as a single PDU.
+type vectorWriter interface {
+	WriteBuffers(v [][]byte) (int, error)
+}
+
+// Started returns a channel, which is closed once the Loop has started
+// receiving requests. Any request or confirmation received afterwards is
+// handled, and the CCCDs stored in the CCCDStore, if any, have been restored.
+func (s *Server) Started() <-chan struct{} {
+	return s.started
+}
+
+// afterResponse does the work deferred until the response has been sent.
+func (s *Server) afterResponse() {
+	if s.pendingMTU != 0 {
+		s.applyMTU()
+	}
+	s.afterMu.Lock()
+	nn := s.afterRsp
+	s.afterRsp = nil
+	s.afterMu.Unlock()
+	for _, n := range nn {
+		if s.StrictNotify && !s.subscribed(n.h, false) {
+			logger.Error("server", "notify", fmt.Sprintf("can't notify 0x%04X: %s", n.h, ErrNotSubscribed))
+			continue
+		}
+		if _, err := s.notify(n.h, n.data); err != nil {
+			logger.Error("server", "notify", fmt.Sprintf("can't notify 0x%04X: %s", n.h, err))
+		}
+	}
+}
+
+// ProcessRequest handles the request PDU, and returns the response, if any,
+// without reading from or writing the response to the underlying connection.
+// Notifications and indications are still sent to the connection.
+// It's meant for testing the handlers of a Server, which is not looping;
+// it must not be called concurrently with Loop.
+func (s *Server) ProcessRequest(pdu []byte) []byte {
+	if len(pdu) == 0 {
+		return nil
+	}
+	var out []byte
+	rsp := s.handleRequest(pdu)
+	if s.ResponseInterceptor != nil {
+		rsp = s.intercept(pdu, rsp)
+	}
+	if len(rsp) != 0 {
+		out = append(append([]byte{}, rsp...), s.rspTail...)
+		s.rspTail = nil
+	}
+	s.afterResponse()
+	return out
+}
+
+// intercept passes the request req, and its response rsp, including the
+// rspTail, to the ResponseInterceptor, and returns the response to send.
+func (s *Server) intercept(req, rsp []byte) []byte {
+	if s.rspTail != nil {
+		rsp = append(append([]byte{}, rsp...), s.rspTail...)
+		s.rspTail = nil
+	}
+	return s.ResponseInterceptor(req, rsp)
+}
+
+// send writes the response rsp, followed by the rspTail, if any.
+func (s *Server) send(rsp []byte) (int, error) {
+	if s.rspTail == nil {
+		return s.conn.Write(rsp)
+	}
+	tail := s.rspTail
+	s.rspTail = nil
+	return s.conn.Conn.(vectorWriter).WriteBuffers([][]byte{rsp, tail})
+}
+
+// restoreCCCs restores the Client Characteristic Configurations of the peer
+// from the CCCDStore, as if they were written by the peer. The upper layer
+// is told of the subscriptions by having its handlers invoked as usual.
+func (s *Server) restoreCCCs() {
+	if s.CCCDStore == nil {
+		return
+	}
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	for _, a := range s.db.subrangeOfType(ble.ClientCharacteristicConfigUUID, 0x0001, 0xFFFF) {
+		ccc, err := s.CCCDStore.Load(s.conn.RemoteAddr(), a.h)
+		if err != nil {
+			logger.Error("server", "ccc", fmt.Sprintf("can't load: %s", err))
+			continue
+		}
+		if ccc == 0 || a.wh == nil {
+			continue
+		}
+		b := make([]byte, 2)
+		binary.LittleEndian.PutUint16(b, ccc)
+		rsp := ble.NewResponseWriter(nil)
+		rsp.SetStatus(ble.ErrSuccess)
+		a.wh.ServeWrite(ble.NewAttributeRequest(s.conn, b, 0, a.h, a.typ), rsp)
+	}
+}
+
 func (s *Server) handleRequest(b []byte) []byte {
 	var resp []byte
-	logger.Debug("server", "req", fmt.Sprintf("% X", b))
+	if logger.IsDebug() {
+		logger.Debug("server", "req", fmt.Sprintf("% X", b))
+	}
+	if s.disabled[b[0]] {
+		if b[0]&cmdFlag != 0 {
+			return nil
+		}
+		resp = s.errorResponse(b[0], 0x0000, ble.ErrReqNotSupp)
+		logger.Debug("server", "rsp", fmt.Sprintf("% X", resp))
+		return resp
+	}
+	if len(b) > s.rxMTU {
+		logger.Error("server", "req", fmt.Sprintf("PDU of %d bytes exceeds the rxMTU %d", len(b), s.rxMTU))
+		if b[0]&cmdFlag != 0 {
+			return nil
+		}
+		resp = s.errorResponse(b[0], 0x0000, ble.ErrInvalidPDU)
+		logger.Debug("server", "rsp", fmt.Sprintf("% X", resp))
+		return resp
+	}
+	if e := s.mtuGated[b[0]]; e != ble.ErrSuccess && !s.MTUExchanged() {
+		if b[0]&cmdFlag != 0 {
+			return nil
+		}
+		resp = s.errorResponse(b[0], 0x0000, e)
+		logger.Debug("server", "rsp", fmt.Sprintf("% X", resp))
+		return resp
+	}
+	// The Authentication Signature Flag is only valid along with the Command
+	// Flag, as requests can't be signed. [Vol 3, Part F, 3.3.1]
+	if b[0]&sigFlag != 0 && b[0]&cmdFlag == 0 {
+		resp = s.errorResponse(b[0], 0x0000, ble.ErrInvalidPDU)
+		logger.Debug("server", "rsp", fmt.Sprintf("% X", resp))
+		return resp
+	}
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	if e := validateLength(b[0], b); e != ble.ErrSuccess {
+		// Commands are never responded, even if they are malformed.
+		if b[0]&cmdFlag != 0 {
+			return nil
+		}
+		resp = s.errorResponse(b[0], 0x0000, e)
+		logger.Debug("server", "rsp", fmt.Sprintf("% X", resp))
+		return resp
+	}
 	switch reqType := b[0]; reqType {
 	case ExchangeMTURequestCode:
 		resp = s.handleExchangeMTURequest(b)
@@ -191,15 +1026,23 @@ func (s *Server) handleRequest(b []byte) []byte {
 		resp = s.handleWriteRequest(b)
 	case WriteCommandCode:
 		s.handleWriteCommand(b)
-	case ReadMultipleRequestCode,
-		PrepareWriteRequestCode,
-		ExecuteWriteRequestCode,
-		SignedWriteCommandCode:
-		fallthrough
+	case PrepareWriteRequestCode:
+		resp = s.handlePrepareWriteRequest(b)
+	case ExecuteWriteRequestCode:
+		resp = s.handleExecuteWriteRequest(b)
+	case ReadMultipleRequestCode:
+		resp = s.handleReadMultipleRequest(b)
 	default:
-		resp = newErrorResponse(reqType, 0x0000, ble.ErrReqNotSupp)
+		// Commands that are not supported, including the Signed Write Command,
+		// are ignored. [Vol 3, Part F, 3.3]
+		if reqType&cmdFlag != 0 {
+			return nil
+		}
+		resp = s.errorResponse(reqType, 0x0000, ble.ErrReqNotSupp)
+	}
+	if logger.IsDebug() {
+		logger.Debug("server", "rsp", fmt.Sprintf("% X", resp))
 	}
-	logger.Debug("server", "rsp", fmt.Sprintf("% X", resp))
 	return resp
 }
 
@@ -207,41 +1050,134 @@ func (s *Server) handleRequest(b []byte) []byte {
 func (s *Server) handleExchangeMTURequest(r ExchangeMTURequest) []byte {
 	// Validate the request.
 	switch {
-	case len(r) != 3:
-		fallthrough
 	case r.ClientRxMTU() < 23:
-		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
+		return s.errorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
 	}
 
+	// The ATT_MTU used in both directions is the minimum of the Client Rx MTU
+	// and the Server Rx MTU. [Vol 3, Part F, 3.4.2.2]
+	rxMTU := s.rxMTU
+	if s.AdvertisedRxMTU >= ble.DefaultMTU && s.AdvertisedRxMTU < rxMTU {
+		rxMTU = s.AdvertisedRxMTU
+	}
+	if s.ExchangeMTUHandler != nil {
+		mtu, e := s.ExchangeMTUHandler(int(r.ClientRxMTU()))
+		switch {
+		case e != ble.ErrSuccess:
+			return s.errorResponse(r.AttributeOpcode(), 0x0000, e)
+		case mtu < ble.DefaultMTU:
+			return s.errorResponse(r.AttributeOpcode(), 0x0000, ble.ErrUnlikely)
+		case mtu < s.rxMTU:
+			rxMTU = mtu
+		default:
+			rxMTU = s.rxMTU
+		}
+	}
 	txMTU := int(r.ClientRxMTU())
-	s.conn.SetTxMTU(txMTU)
-
+	if txMTU > rxMTU {
+		txMTU = rxMTU
+	}
 	if txMTU != len(s.txBuf) {
 		// Apply the txMTU afer this response has been sent and before
-		// any other attribute protocol PDU is sent.
-		defer func() {
-			s.txBuf = make([]byte, txMTU, txMTU)
-			<-s.chNotBuf
-			s.chNotBuf <- make([]byte, txMTU, txMTU)
-			<-s.chIndBuf
-			s.chIndBuf <- make([]byte, txMTU, txMTU)
-		}()
+		// any other attribute protocol PDU is sent. Hold the notification
+		// and indication buffers meanwhile, so no notification or indication
+		// is sent until the buffers are resized by applyMTU.
+		if !s.holdBuffers() {
+			return s.errorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInsuffResources)
+		}
+		s.pendingMTU = txMTU
+	} else {
+		atomic.StoreInt32(&s.mtuExchanged, 1)
 	}
 
 	rsp := ExchangeMTUResponse(s.txBuf)
 	rsp.SetAttributeOpcode()
-	rsp.SetServerRxMTU(uint16(s.rxMTU))
+	rsp.SetServerRxMTU(uint16(rxMTU))
 	return rsp[:3]
 }
 
+// maxBufferWait is the maximum time to wait for the notification and
+// indication buffers, which are held by the ones in flight.
+const maxBufferWait = 100 * time.Millisecond
+
+// holdBuffers acquires both the notification and indication buffers. It gives
+// up after maxBufferWait, e.g. while an indication is waiting for confirmation,
+// so the client can retry the request rather than having it blocked.
+func (s *Server) holdBuffers() bool {
+	var expired <-chan time.Time
+	if s.Clock != nil {
+		expired = s.Clock.After(maxBufferWait)
+	} else {
+		t := time.NewTimer(maxBufferWait)
+		defer t.Stop()
+		expired = t.C
+	}
+	var nBuf []byte
+	select {
+	case nBuf = <-s.chNotBuf:
+	case <-expired:
+		return false
+	}
+	select {
+	case <-s.chIndBuf:
+		return true
+	case <-expired:
+		s.chNotBuf <- nBuf
+		return false
+	}
+}
+
+// applyMTU applies the ATT_MTU negotiated by the Exchange MTU Request, after
+// the response has been sent, and releases the resized notification and
+// indication buffers.
+func (s *Server) applyMTU() {
+	mtu := s.pendingMTU
+	s.pendingMTU = 0
+	s.conn.SetTxMTU(mtu)
+	s.txBuf = make([]byte, mtu, mtu)
+	s.chNotBuf <- make([]byte, mtu, mtu)
+	s.chIndBuf <- make([]byte, mtu, mtu)
+	atomic.StoreInt32(&s.mtuExchanged, 1)
+}
+
+// MTUExchanged reports whether the ATT_MTU has been exchanged with the client.
+// Until then, the default ATT_MTU (23 bytes) is used.
+// MTUExchanged is safe to be called from any goroutine.
+func (s *Server) MTUExchanged() bool {
+	return atomic.LoadInt32(&s.mtuExchanged) != 0
+}
+
+// baseUUID is the Bluetooth Base UUID, in little-endian. [Vol 3, Part B, 2.5.1]
+var baseUUID = ble.MustParse("00000000-0000-1000-8000-00805F9B34FB")
+
+// shortUUID returns the 16-bit form of u, if u is a 128-bit UUID derived
+// from the Bluetooth Base UUID. Otherwise, u is returned as is.
+func shortUUID(u ble.UUID) ble.UUID {
+	if u.Len() == 16 && bytes.Equal(u[:12], baseUUID[:12]) && u[14] == 0 && u[15] == 0 {
+		return u[12:14]
+	}
+	return u
+}
+
+// wireUUID returns u in a length that can be carried in the Find Information
+// Response, which is either 16-bit or 128-bit. A 32-bit UUID is expanded to
+// 128-bit with the Bluetooth Base UUID. It returns nil for invalid lengths.
+func wireUUID(u ble.UUID) ble.UUID {
+	switch u.Len() {
+	case 2, 16:
+		return u
+	case 4:
+		return append(append(ble.UUID{}, baseUUID[:12]...), u...)
+	}
+	return nil
+}
+
 // handle Find Information request. [Vol 3, Part F, 3.4.3.1 & 3.4.3.2]
 func (s *Server) handleFindInformationRequest(r FindInformationRequest) []byte {
 	// Validate the request.
 	switch {
-	case len(r) != 5:
-		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
 	case r.StartingHandle() == 0 || r.StartingHandle() > r.EndingHandle():
-		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
 	}
 
 	rsp := FindInformationResponse(s.txBuf)
@@ -252,41 +1188,49 @@ func (s *Server) handleFindInformationRequest(r FindInformationRequest) []byte {
 
 	// Each response shall contain Types of the same format.
 	for _, a := range s.db.subrange(r.StartingHandle(), r.EndingHandle()) {
+		t := wireUUID(a.typ)
+		if a.hidden || t == nil {
+			continue
+		}
 		if rsp.Format() == 0 {
 			rsp.SetFormat(0x01)
-			if a.typ.Len() == 16 {
+			if t.Len() == 16 {
 				rsp.SetFormat(0x02)
 			}
 		}
-		if rsp.Format() == 0x01 && a.typ.Len() != 2 {
+		if rsp.Format() == 0x01 && t.Len() != 2 {
 			break
 		}
-		if rsp.Format() == 0x02 && a.typ.Len() != 16 {
+		if rsp.Format() == 0x02 && t.Len() != 16 {
 			break
 		}
 
-		if buf.Len()+2+a.typ.Len() > buf.Cap() {
+		if buf.Len()+2+t.Len() > buf.Cap() || s.entriesFull(buf.Len()/(2+t.Len())) {
 			break
 		}
 		binary.Write(buf, binary.LittleEndian, a.h)
-		binary.Write(buf, binary.LittleEndian, a.typ)
+		binary.Write(buf, binary.LittleEndian, t)
 	}
 
 	// Nothing has been found.
 	if rsp.Format() == 0 {
-		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrAttrNotFound)
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrAttrNotFound)
 	}
 	return rsp[:2+buf.Len()]
 }
 
+// entriesFull returns true, if a discovery response holding n entries has
+// reached the MaxEntriesPerResponse.
+func (s *Server) entriesFull(n int) bool {
+	return s.MaxEntriesPerResponse > 0 && n >= s.MaxEntriesPerResponse
+}
+
 // handle Find By Type Value request. [Vol 3, Part F, 3.4.3.3 & 3.4.3.4]
 func (s *Server) handleFindByTypeValueRequest(r FindByTypeValueRequest) []byte {
 	// Validate the request.
 	switch {
-	case len(r) < 7:
-		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
 	case r.StartingHandle() == 0 || r.StartingHandle() > r.EndingHandle():
-		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
 	}
 
 	rsp := FindByTypeValueResponse(s.txBuf)
@@ -294,21 +1238,39 @@ func (s *Server) handleFindByTypeValueRequest(r FindByTypeValueRequest) []byte {
 	buf := bytes.NewBuffer(rsp.HandleInformationList())
 	buf.Reset()
 
-	for _, a := range s.db.subrange(r.StartingHandle(), r.EndingHandle()) {
+	// Only attributes of the requested type are visited, and passed to the handlers.
+	aa := s.db.subrangeOfType(ble.UUID16(r.AttributeType()), r.StartingHandle(), r.EndingHandle())
+	var pre map[*attr]readResult
+	if s.HandlerConcurrency > 1 {
+		var dyn []*attr
+		for _, a := range aa {
+			if !a.hidden && a.v == nil && len(dyn) < buf.Cap()/4 {
+				dyn = append(dyn, a)
+			}
+		}
+		pre = s.prefetch(dyn, len(s.txBuf)-7+1, func(a *attr, rsp ble.ResponseWriter) ble.ATTError {
+			return s.readAttr(a, r, rsp)
+		})
+	}
+	for _, a := range aa {
 		v, starth, endh := a.v, a.h, a.endh
-		if !(ble.UUID(a.typ).Equal(ble.UUID16(r.AttributeType()))) {
+		if a.hidden {
 			continue
 		}
 		if v == nil {
 			// The value shall not exceed ATT_MTU - 7 bytes.
 			// Since ResponseWriter caps the value at the capacity,
 			// we allocate one extra byte, and the written length.
-			buf2 := bytes.NewBuffer(make([]byte, 0, len(s.txBuf)-7+1))
-			e := handleATT(a, s.conn, r, ble.NewResponseWriter(buf2))
-			if e != ble.ErrSuccess || buf2.Len() > len(s.txBuf)-7 {
-				return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
+			res, ok := pre[a]
+			if !ok {
+				buf2 := bytes.NewBuffer(make([]byte, 0, len(s.txBuf)-7+1))
+				res.e = s.readAttr(a, r, ble.NewResponseWriter(buf2))
+				res.v = buf2.Bytes()
+			}
+			if res.e != ble.ErrSuccess || len(res.v) > len(s.txBuf)-7 {
+				return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
 			}
-			endh = a.h
+			v, endh = res.v, a.h
 		}
 		if !(ble.UUID(v).Equal(ble.UUID(r.AttributeValue()))) {
 			continue
@@ -321,20 +1283,27 @@ func (s *Server) handleFindByTypeValueRequest(r FindByTypeValueRequest) []byte {
 		binary.Write(buf, binary.LittleEndian, endh)
 	}
 	if buf.Len() == 0 {
-		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrAttrNotFound)
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrAttrNotFound)
 	}
 
 	return rsp[:1+buf.Len()]
 }
 
 // handle Read By Type request. [Vol 3, Part F, 3.4.4.1 & 3.4.4.2]
+// It also implements the Read Using Characteristic UUID procedure. The status
+// set by the ReadHandler, such as ErrInsuffEnc or ErrInsuffEncrKeySize for an
+// unmet security requirement, is responded as is, with the handle in error.
+//
+// No explicit continuation is needed for paginated sources, e.g. a proxy: the
+// client resumes from the handle following the last one responded. With the
+// ReadByTypePartial policy, a ReadHandler, which can't serve its value yet,
+// sets an error status to end the response before its attribute, and is
+// invoked again by the next request, unless it's the first one matched.
 func (s *Server) handleReadByTypeRequest(r ReadByTypeRequest) []byte {
 	// Validate the request.
 	switch {
-	case len(r) != 7 && len(r) != 21:
-		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
 	case r.StartingHandle() == 0 || r.StartingHandle() > r.EndingHandle():
-		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
 	}
 
 	rsp := ReadByTypeResponse(s.txBuf)
@@ -344,23 +1313,47 @@ func (s *Server) handleReadByTypeRequest(r ReadByTypeRequest) []byte {
 
 	// handle length (2 bytes) + value length.
 	// Each response shall only contains values with the same size.
-	dlen := 0
+	var aa []*attr
 	for _, a := range s.db.subrange(r.StartingHandle(), r.EndingHandle()) {
-		if !a.typ.Equal(ble.UUID(r.AttributeType())) {
-			continue
+		if !a.hidden && a.typ.Equal(ble.UUID(r.AttributeType())) {
+			aa = append(aa, a)
+		}
+	}
+	var pre map[*attr]readResult
+	if s.HandlerConcurrency > 1 {
+		var dyn []*attr
+		for _, a := range aa {
+			if (a.v == nil || a.writeOnly) && len(dyn) < buf.Cap()/2 {
+				dyn = append(dyn, a)
+			}
+		}
+		pre = s.prefetch(dyn, len(s.txBuf)-2, func(a *attr, rsp ble.ResponseWriter) ble.ATTError {
+			return s.readAttr(a, r, rsp)
+		})
+	}
+
+	dlen := 0
+	for _, a := range aa {
+		if dlen != 0 && s.entriesFull(buf.Len()/dlen) {
+			break
 		}
 		v := a.v
-		if v == nil {
-			buf2 := bytes.NewBuffer(make([]byte, 0, len(s.txBuf)-2))
-			if e := handleATT(a, s.conn, r, ble.NewResponseWriter(buf2)); e != ble.ErrSuccess {
-				// Return if the first value read cause an error.
-				if dlen == 0 {
-					return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), e)
+		if v == nil || a.writeOnly {
+			res, ok := pre[a]
+			if !ok {
+				buf2 := bytes.NewBuffer(make([]byte, 0, len(s.txBuf)-2))
+				res.e = s.readAttr(a, r, ble.NewResponseWriter(buf2))
+				res.v = buf2.Bytes()
+			}
+			if e := res.e; e != ble.ErrSuccess {
+				// Return if the first value read cause an error, or the policy asks to.
+				if dlen == 0 || s.ReadByTypePolicy == ReadByTypeAllOrNothing {
+					return s.errorResponse(r.AttributeOpcode(), a.h, e)
 				}
-				// Otherwise, skip to the next one.
+				// Otherwise, respond with the values read so far.
 				break
 			}
-			v = buf2.Bytes()
+			v = res.v
 		}
 		if dlen == 0 {
 			// Found the first value.
@@ -373,6 +1366,10 @@ func (s *Server) handleReadByTypeRequest(r ReadByTypeRequest) []byte {
 			}
 			rsp.SetLength(uint8(dlen))
 		} else if 2+len(v) != dlen {
+			// v is read once, so a handler returning values of varying length
+			// can't change it past this check. A value of another length ends
+			// the response, rather than being skipped, as the client resumes
+			// from the handle following the last one responded.
 			break
 		}
 
@@ -383,19 +1380,43 @@ func (s *Server) handleReadByTypeRequest(r ReadByTypeRequest) []byte {
 		binary.Write(buf, binary.LittleEndian, v[:dlen-2])
 	}
 	if dlen == 0 {
-		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrAttrNotFound)
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrAttrNotFound)
 	}
 	return rsp[:2+buf.Len()]
 }
 
-// handle Read request. [Vol 3, Part F, 3.4.4.3 & 3.4.4.4]
-func (s *Server) handleReadRequest(r ReadRequest) []byte {
-	// Validate the request.
-	switch {
-	case len(r) != 3:
-		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
+// readResult is the value of an attribute read by prefetch.
+type readResult struct {
+	v []byte
+	e ble.ATTError
+}
+
+// prefetch reads the values of aa into buffers of size bytes, with up to
+// HandlerConcurrency reads running concurrently, and returns the results.
+func (s *Server) prefetch(aa []*attr, size int, read func(a *attr, rsp ble.ResponseWriter) ble.ATTError) map[*attr]readResult {
+	rr := make([]readResult, len(aa))
+	sem := make(chan struct{}, s.HandlerConcurrency)
+	var wg sync.WaitGroup
+	for i, a := range aa {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, a *attr) {
+			defer func() { <-sem; wg.Done() }()
+			buf := bytes.NewBuffer(make([]byte, 0, size))
+			rr[i].e = read(a, ble.NewResponseWriter(buf))
+			rr[i].v = buf.Bytes()
+		}(i, a)
 	}
+	wg.Wait()
+	pre := make(map[*attr]readResult, len(aa))
+	for i, a := range aa {
+		pre[a] = rr[i]
+	}
+	return pre
+}
 
+// handle Read request. [Vol 3, Part F, 3.4.4.3 & 3.4.4.4]
+func (s *Server) handleReadRequest(r ReadRequest) []byte {
 	rsp := ReadResponse(s.txBuf)
 	rsp.SetAttributeOpcode()
 	buf := bytes.NewBuffer(rsp.AttributeValue())
@@ -403,34 +1424,50 @@ func (s *Server) handleReadRequest(r ReadRequest) []byte {
 
 	a, ok := s.db.at(r.AttributeHandle())
 	if !ok {
-		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidHandle)
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidHandle)
+	}
+
+	if a.writeOnly {
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrReadNotPerm)
 	}
 
 	// Simple case. Read-only, no-authorization, no-authentication.
 	if a.v != nil {
-		binary.Write(buf, binary.LittleEndian, a.v)
+		v := a.v
+		if len(v) > buf.Cap() {
+			v = v[:buf.Cap()]
+		}
+		s.audit(r.AttributeOpcode(), r.AttributeHandle(), v)
+		// Send the static value as is, if the underlying connection supports vectored IO.
+		if _, ok := s.conn.Conn.(vectorWriter); ok {
+			s.rspTail = v
+			return rsp[:1]
+		}
+		binary.Write(buf, binary.LittleEndian, v)
 		return rsp[:1+buf.Len()]
 	}
 
 	// Pass the request to upper layer with the ResponseWriter, which caps
 	// the buffer to a valid length of payload.
-	if e := handleATT(a, s.conn, r, ble.NewResponseWriter(buf)); e != ble.ErrSuccess {
-		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+	if e := s.readAttr(a, r, ble.NewResponseWriter(buf)); e != ble.ErrSuccess {
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
 	}
+	s.audit(r.AttributeOpcode(), r.AttributeHandle(), buf.Bytes())
 	return rsp[:1+buf.Len()]
 }
 
 // handle Read Blob request. [Vol 3, Part F, 3.4.4.5 & 3.4.4.6]
+// Each Read Blob Request is an independent transaction, and no state is kept
+// between them. An error set by the ReadHandler, e.g. ErrUnlikely, is responded
+// for the requested offset only, and the client may retry the same offset.
+// An offset beyond the length of a static value is responded with
+// ErrInvalidOffset. The length of a value served by a ReadHandler is only
+// known to the handler, which is expected to do the same; the handlers of
+// this package bound the offset with serveLongValue.
 func (s *Server) handleReadBlobRequest(r ReadBlobRequest) []byte {
-	// Validate the request.
-	switch {
-	case len(r) != 5:
-		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
-	}
-
 	a, ok := s.db.at(r.AttributeHandle())
 	if !ok {
-		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidHandle)
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidHandle)
 	}
 
 	rsp := ReadBlobResponse(s.txBuf)
@@ -438,28 +1475,91 @@ func (s *Server) handleReadBlobRequest(r ReadBlobRequest) []byte {
 	buf := bytes.NewBuffer(rsp.PartAttributeValue())
 	buf.Reset()
 
+	if a.writeOnly {
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrReadNotPerm)
+	}
+
 	// Simple case. Read-only, no-authorization, no-authentication.
 	if a.v != nil {
-		binary.Write(buf, binary.LittleEndian, a.v)
+		// An offset equal to the length reads an empty part. [Vol 3, Part F, 3.4.4.5]
+		if int(r.ValueOffset()) > len(a.v) {
+			return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidOffset)
+		}
+		v := a.v[r.ValueOffset():]
+		if len(v) > buf.Cap() {
+			v = v[:buf.Cap()]
+		}
+		s.audit(r.AttributeOpcode(), r.AttributeHandle(), v)
+		// Send the static value as is, if the underlying connection supports vectored IO.
+		if _, ok := s.conn.Conn.(vectorWriter); ok {
+			s.rspTail = v
+			return rsp[:1]
+		}
+		binary.Write(buf, binary.LittleEndian, v)
 		return rsp[:1+buf.Len()]
 	}
 
 	// Pass the request to upper layer with the ResponseWriter, which caps
 	// the buffer to a valid length of payload.
-	if e := handleATT(a, s.conn, r, ble.NewResponseWriter(buf)); e != ble.ErrSuccess {
-		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+	if e := s.readAttr(a, r, ble.NewResponseWriter(buf)); e != ble.ErrSuccess {
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+	}
+	s.audit(r.AttributeOpcode(), r.AttributeHandle(), buf.Bytes())
+	return rsp[:1+buf.Len()]
+}
+
+// handle Read Multiple request. [Vol 3, Part F, 3.4.4.7 & 3.4.4.8]
+// The values are concatenated in the order of the handles requested. If they
+// don't fit in the response, the response ends with the value that fills it
+// up, which is the only one truncated. All the attributes are read anyway, so
+// the request fails if any of them can't be read.
+func (s *Server) handleReadMultipleRequest(r ReadMultipleRequest) []byte {
+	hh := r.SetOfHandles()
+	if len(hh)%2 != 0 {
+		return s.errorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
+	}
+
+	rsp := ReadMultipleResponse(s.txBuf)
+	rsp.SetAttributeOpcode()
+	buf := bytes.NewBuffer(rsp.SetOfValues())
+	buf.Reset()
+
+	for ; len(hh) > 0; hh = hh[2:] {
+		h := binary.LittleEndian.Uint16(hh)
+		a, ok := s.db.at(h)
+		if !ok {
+			return s.errorResponse(r.AttributeOpcode(), h, ble.ErrInvalidHandle)
+		}
+		v := a.v
+		if v == nil || a.writeOnly {
+			buf2 := bytes.NewBuffer(make([]byte, 0, len(s.txBuf)-1))
+			if e := s.readAttr(a, r, ble.NewResponseWriter(buf2)); e != ble.ErrSuccess {
+				return s.errorResponse(r.AttributeOpcode(), h, e)
+			}
+			v = buf2.Bytes()
+		}
+		if n := buf.Cap() - buf.Len(); len(v) > n {
+			v = v[:n]
+		}
+		buf.Write(v)
+		s.audit(r.AttributeOpcode(), h, v)
 	}
 	return rsp[:1+buf.Len()]
 }
 
-// handle Read Blob request. [Vol 3, Part F, 3.4.4.9 & 3.4.4.10]
+// handle Read By Group Type request. [Vol 3, Part F, 3.4.4.9 & 3.4.4.10]
 func (s *Server) handleReadByGroupRequest(r ReadByGroupTypeRequest) []byte {
 	// Validate the request.
 	switch {
-	case len(r) != 7 && len(r) != 21:
-		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
 	case r.StartingHandle() == 0 || r.StartingHandle() > r.EndingHandle():
-		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
+	}
+
+	// Only the services are grouping attributes, which may be given in either
+	// 16-bit or 128-bit form. [Vol 3, Part G, 2.5.3]
+	t := shortUUID(ble.UUID(r.AttributeGroupType()))
+	if !t.Equal(ble.PrimaryServiceUUID) && !t.Equal(ble.SecondaryServiceUUID) {
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrUnsuppGrpType)
 	}
 
 	rsp := ReadByGroupTypeResponse(s.txBuf)
@@ -469,11 +1569,18 @@ func (s *Server) handleReadByGroupRequest(r ReadByGroupTypeRequest) []byte {
 
 	dlen := 0
 	for _, a := range s.db.subrange(r.StartingHandle(), r.EndingHandle()) {
+		if a.hidden || !a.typ.Equal(t) {
+			continue
+		}
+		// Stop, before invoking any handler, once another entry can't fit.
+		if n := buf.Cap() - buf.Len(); n < 4 || dlen != 0 && (n < dlen || s.entriesFull(buf.Len()/dlen)) {
+			break
+		}
 		v := a.v
 		if v == nil {
-			buf2 := bytes.NewBuffer(make([]byte, buf.Cap()-buf.Len()-4))
-			if e := handleATT(a, s.conn, r, ble.NewResponseWriter(buf2)); e != ble.ErrSuccess {
-				return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), e)
+			buf2 := bytes.NewBuffer(make([]byte, 0, buf.Cap()-buf.Len()-4))
+			if e := s.readAttr(a, r, ble.NewResponseWriter(buf2)); e != ble.ErrSuccess {
+				return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), e)
 			}
 			v = buf2.Bytes()
 		}
@@ -498,55 +1605,315 @@ func (s *Server) handleReadByGroupRequest(r ReadByGroupTypeRequest) []byte {
 		binary.Write(buf, binary.LittleEndian, v[:dlen-4])
 	}
 	if dlen == 0 {
-		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrAttrNotFound)
+		return s.errorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrAttrNotFound)
 	}
 	return rsp[:2+buf.Len()]
 }
 
 // handle Write request. [Vol 3, Part F, 3.4.5.1 & 3.4.5.2]
 func (s *Server) handleWriteRequest(r WriteRequest) []byte {
-	// Validate the request.
-	switch {
-	case len(r) < 3:
-		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
-	}
-
 	a, ok := s.db.at(r.AttributeHandle())
 	if !ok {
-		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidHandle)
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidHandle)
 	}
 
 	// We don't support write to static value. Pass the request to upper layer.
 	if a == nil {
-		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrWriteNotPerm)
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrWriteNotPerm)
 	}
 	if e := handleATT(a, s.conn, r, ble.NewResponseWriter(nil)); e != ble.ErrSuccess {
-		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+	}
+	s.audit(r.AttributeOpcode(), r.AttributeHandle(), r.AttributeValue())
+	if s.OnWriteComplete != nil {
+		s.OnWriteComplete(s.conn, r.AttributeHandle(), r.AttributeValue())
 	}
 	return []byte{WriteResponseCode}
 }
 
 // handle Write command. [Vol 3, Part F, 3.4.5.3]
 func (s *Server) handleWriteCommand(r WriteCommand) []byte {
-	// Validate the request.
-	switch {
-	case len(r) <= 3:
-		return nil
+	e := s.writeCommand(r)
+	if e == ble.ErrSuccess {
+		s.audit(r.AttributeOpcode(), r.AttributeHandle(), r.AttributeValue())
+	}
+	if s.OnWriteCommand != nil {
+		s.OnWriteCommand(r.AttributeHandle(), r.AttributeValue(), e)
 	}
+	return nil
+}
 
+// writeCommand passes the Write Command to the upper layer, and returns the
+// result, which is never sent to the client.
+// A Write Command with an empty value is passed as a zero-length write.
+//
+// Write Commands are the hot path of high-rate control streams, so nothing is
+// allocated: the request is reused, and its value is sliced from the receive
+// buffer. The WriteHandlers must not retain either of them.
+func (s *Server) writeCommand(r WriteCommand) ble.ATTError {
 	a, ok := s.db.at(r.AttributeHandle())
 	if !ok {
-		return nil
+		return ble.ErrInvalidHandle
 	}
 
 	// We don't support write to static value. Pass the request to upper layer.
-	if a == nil {
-		return nil
+	if a == nil || a.wh == nil {
+		return ble.ErrWriteNotPerm
 	}
-	if e := handleATT(a, s.conn, r, s.dummyRspWriter); e != ble.ErrSuccess {
-		return nil
+	s.cmdReq = cmdRequest{conn: s.conn, data: r.AttributeValue(), h: a.h, u: a.typ}
+	s.dummyRspWriter.SetStatus(ble.ErrSuccess)
+	a.wh.ServeWrite(&s.cmdReq, s.dummyRspWriter)
+	return s.dummyRspWriter.Status()
+}
+
+// cmdRequest is the AttributeRequest passed to the WriteHandlers for Write Commands.
+type cmdRequest struct {
+	conn ble.Conn
+	data []byte
+	h    uint16
+	u    ble.UUID
+}
+
+func (r *cmdRequest) Conn() ble.Conn { return r.conn }
+func (r *cmdRequest) Data() []byte   { return r.data }
+func (r *cmdRequest) Offset() int    { return 0 }
+func (r *cmdRequest) Handle() uint16 { return r.h }
+func (r *cmdRequest) UUID() ble.UUID { return r.u }
+
+// maxPrepareQueue is the maximum number of Prepare Write Requests queued.
+const maxPrepareQueue = 64
+
+// A PreparedWrite is a part of attribute value queued by a Prepare Write Request.
+type PreparedWrite struct {
+	Handle uint16
+	Offset uint16
+	Value  []byte
+}
+
+// PreparedWrites returns the queued Prepare Write Requests in the order they
+// were received. It's meant to be called by the WriteHandlers, which are
+// invoked by an Execute Write Request, to validate the queued parts before
+// the value is committed.
+//
+// On an Execute Write Request, all the values are validated first, and then
+// passed to their WriteHandlers one by one. If any of the handlers fails,
+// the request is responded with the error and the handle of the attribute,
+// the rest are not passed, and the queue is cleared. The values already
+// passed are not rolled back.
+func (s *Server) PreparedWrites() []PreparedWrite {
+	return append([]PreparedWrite{}, s.prepared...)
+}
+
+// handle Prepare Write request. [Vol 3, Part F, 3.4.6.1 & 3.4.6.2]
+func (s *Server) handlePrepareWriteRequest(r PrepareWriteRequest) []byte {
+	a, ok := s.db.at(r.AttributeHandle())
+	if !ok {
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidHandle)
 	}
-	return nil
+	if a.wh == nil {
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrWriteNotPerm)
+	}
+	if len(s.prepared) >= maxPrepareQueue {
+		return s.errorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrPrepQueueFull)
+	}
+	s.prepared = append(s.prepared, PreparedWrite{
+		Handle: r.AttributeHandle(),
+		Offset: r.ValueOffset(),
+		Value:  append([]byte{}, r.PartAttributeValue()...),
+	})
+
+	// Echo the request back, so the client can verify the value was received correctly.
+	rsp := PrepareWriteResponse(s.txBuf)
+	n := copy(rsp, r)
+	rsp.SetAttributeOpcode()
+	return rsp[:n]
+}
+
+// handle Execute Write request. [Vol 3, Part F, 3.4.6.3 & 3.4.6.4]
+func (s *Server) handleExecuteWriteRequest(r ExecuteWriteRequest) []byte {
+	// The queue is cleared no matter the request is executed or cancelled.
+	defer func() { s.prepared = nil }()
+
+	switch r.Flags() {
+	case 0x00:
+		// Cancel all prepared writes.
+	case 0x01:
+		// Immediately write all pending prepared values.
+		if h, e := s.executeWrites(); e != ble.ErrSuccess {
+			return s.errorResponse(r.AttributeOpcode(), h, e)
+		}
+	default:
+		return s.errorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
+	}
+	rsp := ExecuteWriteResponse(s.txBuf)
+	rsp.SetAttributeOpcode()
+	return rsp[:1]
+}
+
+// executeWrites reassembles the queued parts of each attribute, and passes
+// the values to the upper layer in the order the attributes were prepared.
+// It returns the handle of the attribute in error, if any.
+//
+// All the values are validated before any of them is passed to the upper
+// layer. Committing them is best-effort: if a WriteHandler fails, the rest
+// are not passed, and the ones already passed are not rolled back.
+func (s *Server) executeWrites() (uint16, ble.ATTError) {
+	pp := s.prepared
+	if s.StrictPrepareWrites {
+		pp = append([]PreparedWrite{}, pp...)
+		sort.Stable(byHandleOffset(pp))
+		if h, e := checkOffsets(pp); e != ble.ErrSuccess {
+			return h, e
+		}
+	}
+	var hh []uint16
+	vv := make(map[uint16][]byte)
+	for _, p := range pp {
+		v, ok := vv[p.Handle]
+		if !ok {
+			hh = append(hh, p.Handle)
+		}
+		if int(p.Offset) > len(v) {
+			return p.Handle, ble.ErrInvalidOffset
+		}
+		if end := int(p.Offset) + len(p.Value); end > len(v) {
+			v = append(v, make([]byte, end-len(v))...)
+		}
+		copy(v[p.Offset:], p.Value)
+		if len(v) > ble.MaxMTU-3 {
+			return p.Handle, ble.ErrInvalAttrValueLen
+		}
+		vv[p.Handle] = v
+	}
+	// The attributes may have gone, if the DB was replaced after the values were queued.
+	aa := make([]*attr, len(hh))
+	for i, h := range hh {
+		a, ok := s.db.at(h)
+		if !ok {
+			return h, ble.ErrInvalidHandle
+		}
+		if a.wh == nil {
+			return h, ble.ErrWriteNotPerm
+		}
+		aa[i] = a
+	}
+
+	// Commit the values. A failure stops the commit, but the values committed
+	// so far are not rolled back.
+	for i, h := range hh {
+		a := aa[i]
+		rsp := ble.NewResponseWriter(nil)
+		rsp.SetStatus(ble.ErrSuccess)
+		a.wh.ServeWrite(ble.NewAttributeRequest(s.conn, vv[h], 0, a.h, a.typ), rsp)
+		if e := rsp.Status(); e != ble.ErrSuccess {
+			return h, e
+		}
+		s.audit(ExecuteWriteRequestCode, h, vv[h])
+	}
+	return 0x0000, ble.ErrSuccess
+}
+
+// checkOffsets verifies the parts of each attribute, sorted by byHandleOffset,
+// form a contiguous value from offset 0, without any gap or overlap.
+func checkOffsets(pp []PreparedWrite) (uint16, ble.ATTError) {
+	end := 0
+	for i, p := range pp {
+		if i == 0 || p.Handle != pp[i-1].Handle {
+			end = 0
+		}
+		if int(p.Offset) != end {
+			return p.Handle, ble.ErrInvalidOffset
+		}
+		end += len(p.Value)
+	}
+	return 0x0000, ble.ErrSuccess
+}
+
+// byHandleOffset sorts PreparedWrites by their handles, and then offsets.
+type byHandleOffset []PreparedWrite
+
+func (p byHandleOffset) Len() int      { return len(p) }
+func (p byHandleOffset) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byHandleOffset) Less(i, j int) bool {
+	if p[i].Handle != p[j].Handle {
+		return p[i].Handle < p[j].Handle
+	}
+	return p[i].Offset < p[j].Offset
+}
+
+// audit passes a successful access to an attribute to the AuditHook, if it's set.
+func (s *Server) audit(op byte, h uint16, v []byte) {
+	if s.AuditHook != nil {
+		s.AuditHook(s.conn, op, h, v)
+	}
+}
+
+// LastError describes the last Error Response sent by the Server.
+type LastError struct {
+	RequestOpcode byte         // Opcode of the request in error.
+	Handle        uint16       // Handle of the attribute in error.
+	Code          ble.ATTError // Error code.
+	Time          time.Time    // Time the Error Response was generated.
+}
+
+// LastError returns the last Error Response generated by the Server.
+// It returns false if no Error Response has been generated.
+// LastError is safe to be called from any goroutine.
+func (s *Server) LastError() (LastError, bool) {
+	e, ok := s.lastErr.Load().(LastError)
+	return e, ok
+}
+
+// now returns the current time of the Clock of s.
+func (s *Server) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock.Now()
+	}
+	return time.Now()
+}
+
+// DroppedRequests returns the number of requests dropped without being
+// responded, as the error responses exceeded the MaxErrorRate.
+// DroppedRequests is safe to be called from any goroutine.
+func (s *Server) DroppedRequests() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// ErrorCounts returns the number of Error Responses generated by the Server
+// for each error code, including the ones dropped for the MaxErrorRate. The
+// codes never generated are omitted. For example, a spike of ErrInvalidHandle
+// suggests a client working with a stale discovery of the server.
+// ErrorCounts is safe to be called from any goroutine.
+func (s *Server) ErrorCounts() map[ble.ATTError]uint64 {
+	m := make(map[ble.ATTError]uint64)
+	for i := range s.errCounts {
+		if n := atomic.LoadUint64(&s.errCounts[i]); n != 0 {
+			m[ble.ATTError(i)] = n
+		}
+	}
+	return m
+}
+
+// errorResponse returns an Error Response, and records it as the last error.
+// It returns nil, if the MaxErrorRate has been exceeded.
+func (s *Server) errorResponse(op byte, h uint16, e ble.ATTError) []byte {
+	now := s.now()
+	s.lastErr.Store(LastError{RequestOpcode: op, Handle: h, Code: e, Time: now})
+	atomic.AddUint64(&s.errCounts[byte(e)], 1)
+	if op == ExchangeMTURequestCode && s.OnMTUExchangeError != nil {
+		s.OnMTUExchangeError(e)
+	}
+	if s.MaxErrorRate > 0 {
+		if now.Sub(s.errWindow) >= time.Second {
+			s.errWindow = now
+			s.errCount = 0
+		}
+		if s.errCount++; s.errCount > s.MaxErrorRate {
+			atomic.AddUint64(&s.dropped, 1)
+			return nil
+		}
+	}
+	return newErrorResponse(op, h, e)
 }
 
 func newErrorResponse(op byte, h uint16, s ble.ATTError) []byte {
@@ -558,24 +1925,46 @@ func newErrorResponse(op byte, h uint16, s ble.ATTError) []byte {
 	return r
 }
 
+// readAttr passes the read request to the upper layer, unless the attribute is write-only.
+// Attributes without a ReadHandler are passed to the DefaultReadHandler, if it's set,
+// and reported as ErrInvalidHandle otherwise.
+func (s *Server) readAttr(a *attr, req []byte, rsp ble.ResponseWriter) ble.ATTError {
+	if a.writeOnly {
+		return ble.ErrReadNotPerm
+	}
+	if a.rh == nil && s.DefaultReadHandler == nil {
+		return ble.ErrInvalidHandle
+	}
+	if a.rh == nil {
+		offset := 0
+		if req[0] == ReadBlobRequestCode {
+			offset = int(ReadBlobRequest(req).ValueOffset())
+		}
+		rsp.SetStatus(ble.ErrSuccess)
+		s.DefaultReadHandler(a.h, ble.NewAttributeRequest(s.conn, nil, offset, a.h, a.typ), rsp)
+		return rsp.Status()
+	}
+	return handleATT(a, s.conn, req, rsp)
+}
+
 func handleATT(a *attr, conn ble.Conn, req []byte, rsp ble.ResponseWriter) ble.ATTError {
 	rsp.SetStatus(ble.ErrSuccess)
 	var offset int
 	var data []byte
 	switch req[0] {
-	case ReadByTypeRequestCode:
+	case ReadByTypeRequestCode, ReadMultipleRequestCode, FindByTypeValueRequestCode, ReadByGroupTypeRequestCode:
 		fallthrough
 	case ReadRequestCode:
 		if a.rh == nil {
 			return ble.ErrReadNotPerm
 		}
-		a.rh.ServeRead(ble.NewRequest(conn, data, offset), rsp)
+		a.rh.ServeRead(ble.NewAttributeRequest(conn, data, offset, a.h, a.typ), rsp)
 	case ReadBlobRequestCode:
 		if a.rh == nil {
 			return ble.ErrReadNotPerm
 		}
 		offset = int(ReadBlobRequest(req).ValueOffset())
-		a.rh.ServeRead(ble.NewRequest(conn, data, offset), rsp)
+		a.rh.ServeRead(ble.NewAttributeRequest(conn, data, offset, a.h, a.typ), rsp)
 	case WriteRequestCode:
 		fallthrough
 	case WriteCommandCode:
@@ -583,12 +1972,10 @@ func handleATT(a *attr, conn ble.Conn, req []byte, rsp ble.ResponseWriter) ble.A
 			return ble.ErrWriteNotPerm
 		}
 		data = WriteRequest(req).AttributeValue()
-		a.wh.ServeWrite(ble.NewRequest(conn, data, offset), rsp)
+		a.wh.ServeWrite(ble.NewAttributeRequest(conn, data, offset, a.h, a.typ), rsp)
 	// case PrepareWriteRequestCode:
 	// case ExecuteWriteRequestCode:
 	// case SignedWriteCommandCode:
-	// case ReadByGroupTypeRequestCode:
-	// case ReadMultipleRequestCode:
 	default:
 		return ble.ErrReqNotSupp
 	}
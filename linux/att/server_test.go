@@ -0,0 +1,2063 @@
+package att
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/currantlabs/ble"
+	"golang.org/x/net/context"
+)
+
+// testConn is a ble.Conn, which carries the PDUs written to in, and the ones
+// sent by the server to out.
+type testConn struct {
+	in     chan []byte
+	out    chan []byte
+	rxMTU  int
+	txMTU  int
+	closed chan struct{}
+	ctx    context.Context
+}
+
+func newTestConn(rxMTU int) *testConn {
+	return &testConn{
+		in:     make(chan []byte, 16),
+		out:    make(chan []byte, 64),
+		rxMTU:  rxMTU,
+		txMTU:  ble.DefaultMTU,
+		closed: make(chan struct{}),
+		ctx:    context.Background(),
+	}
+}
+
+func (c *testConn) Read(b []byte) (int, error) {
+	select {
+	case p := <-c.in:
+		return copy(b, p), nil
+	case <-c.closed:
+		return 0, io.EOF
+	}
+}
+
+func (c *testConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	c.out <- append([]byte{}, b...)
+	return len(b), nil
+}
+
+func (c *testConn) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return nil
+}
+
+func (c *testConn) Context() context.Context       { return c.ctx }
+func (c *testConn) SetContext(ctx context.Context) { c.ctx = ctx }
+func (c *testConn) LocalAddr() ble.Addr            { return ble.NewAddr("11:22:33:44:55:66") }
+func (c *testConn) RemoteAddr() ble.Addr           { return ble.NewAddr("AA:BB:CC:DD:EE:FF") }
+func (c *testConn) RxMTU() int                     { return c.rxMTU }
+func (c *testConn) SetRxMTU(mtu int)               { c.rxMTU = mtu }
+func (c *testConn) TxMTU() int                     { return c.txMTU }
+func (c *testConn) SetTxMTU(mtu int)               { c.txMTU = mtu }
+func (c *testConn) Disconnected() <-chan struct{}  { return c.closed }
+
+// request sends the PDU req to the server, and returns the PDU it sends back.
+func (c *testConn) request(t testing.TB, req []byte) []byte {
+	t.Helper()
+	c.in <- req
+	return c.recv(t)
+}
+
+// recv returns the next PDU sent by the server.
+func (c *testConn) recv(t testing.TB) []byte {
+	t.Helper()
+	select {
+	case b := <-c.out:
+		return b
+	case <-time.After(time.Second):
+		t.Fatal("nothing has been sent")
+	}
+	return nil
+}
+
+// testServices returns the services served in the tests:
+//
+//	0x0001 Generic Access service
+//	0x0002 Device Name declaration, 0x0003 value "Gopher"
+//	0x0004 Appearance declaration, 0x0005 value (read, write, notify)
+//	0x0006 Appearance CCCD
+//	0x0007 128-bit service
+//	0x0008 Battery Level declaration, 0x0009 value {99}
+func testServices() []*ble.Service {
+	s := ble.NewService(ble.GAPUUID)
+	s.NewCharacteristic(ble.DeviceNameUUID).SetValue([]byte("Gopher"))
+	c := s.NewCharacteristic(ble.AppearanceUUID)
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		rsp.Write([]byte{0x01, 0x02})
+	}))
+	c.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {}))
+	c.HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {
+		<-n.Context().Done()
+	}))
+	s2 := ble.NewService(ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7"))
+	s2.NewCharacteristic(ble.BatteryLevelUUID).SetValue([]byte{99})
+	return []*ble.Service{s, s2}
+}
+
+// newTestServer returns a looping Server serving ss, and its connection.
+// The connection is closed, once the test completes.
+func newTestServer(t testing.TB, ss []*ble.Service, opts ...Option) (*Server, *testConn) {
+	t.Helper()
+	return newTestServerDB(t, NewDB(ss, 1), opts...)
+}
+
+// newTestServerDB is newTestServer serving db.
+func newTestServerDB(t testing.TB, db *DB, opts ...Option) (*Server, *testConn) {
+	t.Helper()
+	c := newTestConn(ble.MaxMTU)
+	s, err := NewServer(db, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Option(opts...); err != nil {
+		t.Fatal(err)
+	}
+	go s.Loop()
+	<-s.Started()
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+// pdu concatenates the fields of a PDU.
+func pdu(fields ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, f := range fields {
+		switch v := f.(type) {
+		case byte:
+			b.WriteByte(v)
+		case int:
+			b.WriteByte(byte(v))
+		case uint16:
+			binary.Write(&b, binary.LittleEndian, v)
+		case []byte:
+			b.Write(v)
+		case ble.UUID:
+			b.Write(v)
+		case string:
+			b.WriteString(v)
+		default:
+			panic("unsupported field")
+		}
+	}
+	return b.Bytes()
+}
+
+func TestCancelIndication(t *testing.T) {
+	s, c := newTestServer(t, testServices())
+	s.IndicationTimeout = 0
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.indicate(0x0005, []byte{0x01}, s.IndicationTimeout)
+		done <- err
+	}()
+	if b := c.recv(t); b[0] != HandleValueIndicationCode {
+		t.Fatalf("sent % X, want an indication", b)
+	}
+	s.CancelIndication()
+	if err := <-done; err != ErrIndicationCancelled {
+		t.Fatalf("cancelled indication returned %v, want %v", err, ErrIndicationCancelled)
+	}
+
+	// The confirmation of the cancelled indication arrives late, and must not
+	// be taken for the confirmation of the next one, nor swallow it.
+	c.in <- []byte{HandleValueConfirmationCode}
+	go func() {
+		_, err := s.indicate(0x0005, []byte{0x02}, s.IndicationTimeout)
+		done <- err
+	}()
+	if b := c.recv(t); !bytes.Equal(b, pdu(HandleValueIndicationCode, uint16(0x0005), 0x02)) {
+		t.Fatalf("sent % X, want the second indication", b)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("second indication returned %v before it's confirmed", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.in <- []byte{HandleValueConfirmationCode}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("second indication returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the confirmation of the second indication has been dropped")
+	}
+}
+
+func TestCancelIndicationRacingConfirmation(t *testing.T) {
+	s, c := newTestServer(t, testServices())
+	s.IndicationTimeout = 0
+	for i := 0; i < 100; i++ {
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.indicate(0x0005, []byte{byte(i)}, s.IndicationTimeout)
+			done <- err
+		}()
+		c.recv(t)
+		// Either the confirmation or the cancellation wins; both must leave
+		// the server in a state where the next indication is confirmed.
+		c.in <- []byte{HandleValueConfirmationCode}
+		s.CancelIndication()
+		if err := <-done; err != nil && err != ErrIndicationCancelled {
+			t.Fatalf("indication %d returned %v", i, err)
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.indicate(0x0005, []byte{0xFF}, time.Second)
+		done <- err
+	}()
+	c.recv(t)
+	c.in <- []byte{HandleValueConfirmationCode}
+	if err := <-done; err != nil {
+		t.Fatalf("last indication returned %v", err)
+	}
+}
+
+// proxyServices returns a service, whose characteristic 0x2A77 at 0x0003 has
+// neither a static value nor a ReadHandler, as in a proxy, and whose
+// characteristic 0x2A78 at 0x0005 is write-only.
+func proxyServices() []*ble.Service {
+	s := ble.NewService(ble.UUID16(0x1810))
+	c := s.NewCharacteristic(ble.UUID16(0x2A77))
+	c.Property = ble.CharRead
+	w := s.NewCharacteristic(ble.UUID16(0x2A78))
+	w.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {}))
+	return []*ble.Service{s}
+}
+
+func TestDefaultReadHandler(t *testing.T) {
+	if _, err := BuildDB(proxyServices(), 1); err != nil {
+		t.Fatalf("BuildDB rejected a value left to the DefaultReadHandler: %s", err)
+	}
+
+	_, c := newTestServer(t, proxyServices())
+	if b := c.request(t, pdu(ReadRequestCode, uint16(0x0003))); !bytes.Equal(b, newErrorResponse(ReadRequestCode, 0x0003, ble.ErrInvalidHandle)) {
+		t.Errorf("read without handlers responded % X, want ErrInvalidHandle", b)
+	}
+
+	var offsets []int
+	_, c = newTestServer(t, proxyServices(), OptDefaultReadHandler(func(h uint16, req ble.Request, rsp ble.ResponseWriter) {
+		offsets = append(offsets, req.Offset())
+		rsp.Write([]byte("proxied")[req.Offset():])
+	}))
+	for _, tc := range []struct {
+		req  []byte
+		want []byte
+	}{
+		{pdu(ReadRequestCode, uint16(0x0003)), pdu(ReadResponseCode, "proxied")},
+		{pdu(ReadBlobRequestCode, uint16(0x0003), uint16(3)), pdu(ReadBlobResponseCode, "xied")},
+		{pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), uint16(0x2A77)), pdu(ReadByTypeResponseCode, 9, uint16(0x0003), "proxied")},
+		{pdu(FindByTypeValueRequestCode, uint16(0x0001), uint16(0xFFFF), uint16(0x2A77), "proxied"), pdu(FindByTypeValueResponseCode, uint16(0x0003), uint16(0x0003))},
+		// The write-only value is never passed to the DefaultReadHandler.
+		{pdu(ReadRequestCode, uint16(0x0005)), newErrorResponse(ReadRequestCode, 0x0005, ble.ErrReadNotPerm)},
+	} {
+		if b := c.request(t, tc.req); !bytes.Equal(b, tc.want) {
+			t.Errorf("% X responded % X, want % X", tc.req, b, tc.want)
+		}
+	}
+	if want := []int{0, 3, 0, 0}; fmt.Sprint(offsets) != fmt.Sprint(want) {
+		t.Errorf("DefaultReadHandler got offsets %v, want %v", offsets, want)
+	}
+}
+
+func TestReadByGroupTypeBufferEdge(t *testing.T) {
+	var ss []*ble.Service
+	for i := 0; i < 5; i++ {
+		ss = append(ss, ble.NewService(ble.UUID16(0x1810+uint16(i))))
+	}
+	db := NewDB(ss, 1)
+	// Serve the service declarations of the odd handles dynamically.
+	for _, a := range db.attrs {
+		if a.h%2 == 1 {
+			v := a.v
+			a.v = nil
+			a.rh = ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) { rsp.Write(v) })
+		}
+	}
+	c := newTestConn(ble.MaxMTU)
+	s, err := NewServer(db, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Loop()
+	defer c.Close()
+
+	// The response of the default ATT_MTU holds 3 entries of 6 bytes, and
+	// leaves 1 byte, which can't hold another one.
+	for _, tc := range []struct {
+		start uint16
+		want  []byte
+	}{
+		{0x0001, pdu(ReadByGroupTypeResponseCode, 6,
+			uint16(1), uint16(1), uint16(0x1810),
+			uint16(2), uint16(2), uint16(0x1811),
+			uint16(3), uint16(3), uint16(0x1812))},
+		{0x0004, pdu(ReadByGroupTypeResponseCode, 6,
+			uint16(4), uint16(4), uint16(0x1813),
+			uint16(5), uint16(0xFFFF), uint16(0x1814))},
+	} {
+		req := pdu(ReadByGroupTypeRequestCode, tc.start, uint16(0xFFFF), ble.PrimaryServiceUUID)
+		if b := c.request(t, req); !bytes.Equal(b, tc.want) {
+			t.Errorf("% X responded\n% X, want\n% X", req, b, tc.want)
+		}
+	}
+}
+
+func TestNotifyAfterResponseConcurrent(t *testing.T) {
+	var ss []*ble.Service
+	for i := 0; i < 4; i++ {
+		svc := ble.NewService(ble.UUID16(0xFFF0))
+		ss = append(ss, svc)
+		c := svc.NewCharacteristic(ble.UUID16(0xFFF1))
+		c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			h := req.(ble.AttributeRequest).Handle()
+			if err := RespondThenNotify(req, h, []byte{byte(h)}); err != nil {
+				t.Error(err)
+			}
+			rsp.Write([]byte{byte(h)})
+		}))
+	}
+	concurrency := func(s *Server) error { s.HandlerConcurrency = 4; return nil }
+	_, c := newTestServer(t, ss, concurrency)
+
+	req := pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.UUID16(0xFFF1))
+	want := pdu(ReadByTypeResponseCode, 3, uint16(3), 3, uint16(6), 6, uint16(9), 9, uint16(12), 12)
+	for i := 0; i < 10; i++ {
+		if b := c.request(t, req); !bytes.Equal(b, want) {
+			t.Fatalf("got [% X], want [% X]", b, want)
+		}
+		// The notifications follow the response, in the order the
+		// handlers happened to be invoked.
+		got := map[string]bool{}
+		for j := 0; j < 4; j++ {
+			got[string(c.recv(t))] = true
+		}
+		for _, h := range []int{3, 6, 9, 12} {
+			if n := pdu(HandleValueNotificationCode, uint16(h), h); !got[string(n)] {
+				t.Errorf("notification [% X] not sent", n)
+			}
+		}
+	}
+}
+
+func TestSetDBDuringReads(t *testing.T) {
+	// Both DBs have two characteristics of the same type, whose values are
+	// the same within a DB, so a response mixing the DBs is told apart.
+	newDB := func(v string) *DB {
+		svc := ble.NewService(ble.UUID16(0xFFF0))
+		svc.NewCharacteristic(ble.UUID16(0xFFF1)).SetValue([]byte(v))
+		svc.NewCharacteristic(ble.UUID16(0xFFF2)).SetValue([]byte(v + v))
+		dyn := ble.NewService(ble.UUID16(0xFFF0))
+		dyn.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			rsp.Write([]byte(v))
+		}))
+		return NewDB([]*ble.Service{svc, dyn}, 1)
+	}
+	dbs := []*DB{newDB("old"), newDB("new")}
+	s, c := newTestServer(t, nil)
+	s.SetDB(dbs[0])
+
+	done := make(chan struct{})
+	swapped := make(chan struct{})
+	go func() {
+		defer close(swapped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				s.SetDB(dbs[i%2])
+			}
+		}
+	}()
+	defer func() { close(done); <-swapped }()
+
+	want := map[string]bool{}
+	for _, v := range []string{"old", "new"} {
+		want[string(pdu(ReadByTypeResponseCode, 5, uint16(0x0003), v, uint16(0x0008), v))] = true
+		want[string(pdu(ReadResponseCode, v+v))] = true
+	}
+	for i := 0; i < 200; i++ {
+		for _, req := range [][]byte{
+			pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.UUID16(0xFFF1)),
+			pdu(ReadRequestCode, uint16(0x0005)),
+		} {
+			if b := c.request(t, req); !want[string(b)] {
+				t.Fatalf("[% X] responded [% X]", req, b)
+			}
+		}
+	}
+}
+
+func TestSecurityErrors(t *testing.T) {
+	for _, e := range []ble.ATTError{
+		ble.ErrAuthentication,
+		ble.ErrAuthorization,
+		ble.ErrInsuffEncrKeySize,
+		ble.ErrInsuffEnc,
+	} {
+		t.Run(e.Error(), func(t *testing.T) {
+			svc := ble.NewService(ble.UUID16(0xFFF0))
+			svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+				rsp.SetStatus(e)
+			}))
+			_, c := newTestServer(t, []*ble.Service{svc})
+
+			// The Read By Type Request implements Read Using Characteristic UUID.
+			for _, req := range [][]byte{
+				pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.UUID16(0xFFF1)),
+				pdu(ReadRequestCode, uint16(0x0003)),
+				pdu(ReadBlobRequestCode, uint16(0x0003), uint16(0)),
+				pdu(ReadMultipleRequestCode, uint16(0x0002), uint16(0x0003)),
+			} {
+				if b, want := c.request(t, req), newErrorResponse(req[0], 0x0003, e); !bytes.Equal(b, want) {
+					t.Errorf("[% X]: got [% X], want [% X]", req, b, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExchangeMTU(t *testing.T) {
+	const serverRxMTU = 185
+	for _, tc := range []struct {
+		name        string
+		clientRxMTU int
+		mtu         int
+	}{
+		{"client bigger", ble.MaxMTU, serverRxMTU},
+		{"client smaller", 100, 100},
+		{"client equal", serverRxMTU, serverRxMTU},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestConn(serverRxMTU)
+			s, err := NewServer(NewDB(testServices(), 1), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go s.Loop()
+			defer c.Close()
+
+			// The Server Rx MTU is responded, whatever the client's is.
+			if b, want := c.request(t, pdu(ExchangeMTURequestCode, uint16(tc.clientRxMTU))), pdu(ExchangeMTUResponseCode, uint16(serverRxMTU)); !bytes.Equal(b, want) {
+				t.Fatalf("got [% X], want [% X]", b, want)
+			}
+			// The notifications are capped at the minimum of both.
+			if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, make([]byte, ble.MaxMTU)); err != nil {
+				t.Fatal(err)
+			}
+			if b := c.recv(t); len(b) != tc.mtu {
+				t.Errorf("notification of %d bytes, want %d", len(b), tc.mtu)
+			}
+		})
+	}
+}
+
+func TestExchangeMTUHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		clientRxMTU int
+		upstream    int // The Rx MTU of the upstream peripheral.
+		err         ble.ATTError
+		rsp         []byte
+		mtu         int
+	}{
+		{"upstream smaller", 200, 100, ble.ErrSuccess, pdu(ExchangeMTUResponseCode, uint16(100)), 100},
+		{"upstream bigger", 100, 200, ble.ErrSuccess, pdu(ExchangeMTUResponseCode, uint16(200)), 100},
+		{"capped", ble.MaxMTU, ble.MaxMTU + 100, ble.ErrSuccess, pdu(ExchangeMTUResponseCode, uint16(ble.MaxMTU)), ble.MaxMTU},
+		{"invalid", 100, ble.DefaultMTU - 1, ble.ErrSuccess, newErrorResponse(ExchangeMTURequestCode, 0x0000, ble.ErrUnlikely), ble.DefaultMTU},
+		{"refused", 100, 0, ble.ErrReqNotSupp, newErrorResponse(ExchangeMTURequestCode, 0x0000, ble.ErrReqNotSupp), ble.DefaultMTU},
+	} {
+		forwarded := 0
+		s, c := newTestServer(t, testServices(), OptExchangeMTUHandler(func(clientRxMTU int) (int, ble.ATTError) {
+			forwarded = clientRxMTU
+			return tc.upstream, tc.err
+		}))
+		if b := c.request(t, pdu(ExchangeMTURequestCode, uint16(tc.clientRxMTU))); !bytes.Equal(b, tc.rsp) {
+			t.Errorf("%s: got [% X], want [% X]", tc.name, b, tc.rsp)
+		}
+		if forwarded != tc.clientRxMTU {
+			t.Errorf("%s: forwarded %d, want %d", tc.name, forwarded, tc.clientRxMTU)
+		}
+		if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, make([]byte, ble.MaxMTU)); err != nil {
+			t.Fatal(err)
+		}
+		if b := c.recv(t); len(b) != tc.mtu {
+			t.Errorf("%s: notification of %d bytes, want %d", tc.name, len(b), tc.mtu)
+		}
+	}
+}
+
+func TestOnMTUExchangeError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  []byte
+		err  ble.ATTError
+	}{
+		{"short", pdu(ExchangeMTURequestCode, 0x20), ble.ErrInvalidPDU},
+		{"long", pdu(ExchangeMTURequestCode, uint16(100), 0x00), ble.ErrInvalidPDU},
+		{"below the default", pdu(ExchangeMTURequestCode, uint16(ble.DefaultMTU-1)), ble.ErrInvalidPDU},
+		{"valid", pdu(ExchangeMTURequestCode, uint16(100)), ble.ErrSuccess},
+	} {
+		var reported []ble.ATTError
+		s, c := newTestServer(t, testServices(), OptOnMTUExchangeError(func(reason ble.ATTError) {
+			reported = append(reported, reason)
+		}))
+		b := c.request(t, tc.req)
+		mtu, want := 100, []ble.ATTError(nil)
+		if tc.err != ble.ErrSuccess {
+			if want := newErrorResponse(ExchangeMTURequestCode, 0x0000, tc.err); !bytes.Equal(b, want) {
+				t.Errorf("%s: got [% X], want [% X]", tc.name, b, want)
+			}
+			mtu, want = ble.DefaultMTU, []ble.ATTError{tc.err}
+		}
+		// The errors of other requests aren't reported.
+		c.request(t, pdu(ReadRequestCode, uint16(0x0100)))
+		if fmt.Sprint(reported) != fmt.Sprint(want) {
+			t.Errorf("%s: reported %v, want %v", tc.name, reported, want)
+		}
+		// The link stays at the default ATT_MTU after a failure.
+		if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, make([]byte, ble.MaxMTU)); err != nil {
+			t.Fatal(err)
+		}
+		if b := c.recv(t); len(b) != mtu {
+			t.Errorf("%s: notification of %d bytes, want %d", tc.name, len(b), mtu)
+		}
+	}
+}
+
+func TestReadBlobError(t *testing.T) {
+	v := make([]byte, 50)
+	for i := range v {
+		v[i] = byte(i)
+	}
+	failed := false
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		// Fail the second part once.
+		if req.Offset() == 22 && !failed {
+			failed = true
+			rsp.SetStatus(ble.ErrUnlikely)
+			return
+		}
+		serveLongValue(req, rsp, v)
+	}))
+	_, c := newTestServer(t, []*ble.Service{svc})
+
+	const h = 0x0003
+	for _, tc := range []struct {
+		req  []byte
+		want []byte
+	}{
+		{pdu(ReadRequestCode, uint16(h)), pdu(ReadResponseCode, v[:22])},
+		{pdu(ReadBlobRequestCode, uint16(h), uint16(22)), newErrorResponse(ReadBlobRequestCode, h, ble.ErrUnlikely)},
+		// Each Read Blob is independent; the client retries the same offset.
+		{pdu(ReadBlobRequestCode, uint16(h), uint16(22)), pdu(ReadBlobResponseCode, v[22:44])},
+		{pdu(ReadBlobRequestCode, uint16(h), uint16(44)), pdu(ReadBlobResponseCode, v[44:])},
+		{pdu(ReadBlobRequestCode, uint16(h), uint16(51)), newErrorResponse(ReadBlobRequestCode, h, ble.ErrInvalidOffset)},
+		{pdu(ReadBlobRequestCode, uint16(0x0010), uint16(0)), newErrorResponse(ReadBlobRequestCode, 0x0010, ble.ErrInvalidHandle)},
+	} {
+		if b := c.request(t, tc.req); !bytes.Equal(b, tc.want) {
+			t.Errorf("[% X]: got [% X], want [% X]", tc.req, b, tc.want)
+		}
+	}
+}
+
+// fakeClock is a Clock, whose time only moves forward with Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock { return &fakeClock{t: time.Unix(1000, 0)} }
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.t.Add(d), c: ch})
+	return ch
+}
+
+// Advance moves the time forward by d, and fires the timers expired.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+	var pending []fakeTimer
+	for _, tm := range c.timers {
+		if tm.at.After(c.t) {
+			pending = append(pending, tm)
+			continue
+		}
+		tm.c <- c.t
+	}
+	c.timers = pending
+}
+
+// pending returns the number of timers not fired yet.
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func TestIndicationTimeoutClock(t *testing.T) {
+	clk := newFakeClock()
+	s, c := newTestServer(t, testServices(), OptClock(clk))
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.IndicateTimeout(0x0005, []byte{0x01}, s.IndicationTimeout)
+		errc <- err
+	}()
+	if b, want := c.recv(t), pdu(HandleValueIndicationCode, uint16(0x0005), 0x01); !bytes.Equal(b, want) {
+		t.Fatalf("sent [% X], want [% X]", b, want)
+	}
+	for clk.pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The indication is pending until the timeout has elapsed in full.
+	clk.Advance(s.IndicationTimeout - time.Second)
+	select {
+	case err := <-errc:
+		t.Fatalf("indication returned %v before the timeout", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	clk.Advance(time.Second)
+	select {
+	case err := <-errc:
+		if err != ErrSeqProtoTimeout {
+			t.Errorf("got %v, want ErrSeqProtoTimeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("indication not timed out")
+	}
+}
+
+func TestIndefiniteIndicationClosed(t *testing.T) {
+	clk := newFakeClock()
+	s, c := newTestServer(t, testServices(), OptClock(clk), OptIndicationTimeout(0))
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.IndicateTimeout(0x0005, []byte{0x01}, s.IndicationTimeout)
+		errc <- err
+	}()
+	c.recv(t)
+
+	// No timeout is set, however long the confirmation takes.
+	clk.Advance(time.Hour)
+	if n := clk.pending(); n != 0 {
+		t.Errorf("%d timers set", n)
+	}
+	select {
+	case err := <-errc:
+		t.Fatalf("indication returned %v before the close", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.Close()
+	select {
+	case err := <-errc:
+		if err != io.ErrClosedPipe {
+			t.Errorf("got %v, want io.ErrClosedPipe", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("indication not unblocked by the close")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	s, c := newTestServer(t, testServices(), OptIndicationTimeout(0))
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.IndicateTimeout(0x0005, []byte{0x01}, s.IndicationTimeout)
+		errc <- err
+	}()
+	c.recv(t)
+	flush := func(ctx context.Context) <-chan error {
+		ch := make(chan error, 1)
+		go func() { ch <- s.Flush(ctx) }()
+		return ch
+	}
+
+	// Flush waits for the confirmation, unless its context is done first.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := flush(ctx)
+	flushed := flush(context.Background())
+	select {
+	case err := <-cancelled:
+		t.Fatalf("Flush returned %v before the confirmation", err)
+	case err := <-flushed:
+		t.Fatalf("Flush returned %v before the confirmation", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case err := <-cancelled:
+		if err != context.Canceled {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flush not unblocked by the cancellation")
+	}
+	select {
+	case err := <-flushed:
+		t.Fatalf("Flush returned %v before the confirmation", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	c.in <- []byte{HandleValueConfirmationCode}
+	for _, ch := range []<-chan error{errc, flushed} {
+		select {
+		case err := <-ch:
+			if err != nil {
+				t.Errorf("got %v, want nil", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("not unblocked by the confirmation")
+		}
+	}
+}
+
+func TestStrictNotify(t *testing.T) {
+	for _, tc := range []struct {
+		strict, subscribed bool
+		err                error
+	}{
+		{false, false, nil},
+		{false, true, nil},
+		{true, false, ErrNotSubscribed},
+		{true, true, nil},
+	} {
+		s, c := newTestServer(t, testServices(), OptStrictNotify(tc.strict))
+		if tc.subscribed {
+			// The CCCD of the Appearance is at 0x0006.
+			if b := c.request(t, pdu(WriteRequestCode, uint16(0x0006), uint16(cccNotify))); !bytes.Equal(b, []byte{WriteResponseCode}) {
+				t.Fatalf("strict %t: can't subscribe: [% X]", tc.strict, b)
+			}
+		}
+		_, err := s.NotifyByUUID(false, ble.AppearanceUUID, []byte{0x01})
+		if err != tc.err {
+			t.Errorf("strict %t, subscribed %t: got %v, want %v", tc.strict, tc.subscribed, err, tc.err)
+		}
+		if err == nil {
+			if b, want := c.recv(t), pdu(HandleValueNotificationCode, uint16(0x0005), 0x01); !bytes.Equal(b, want) {
+				t.Errorf("strict %t, subscribed %t: sent [% X], want [% X]", tc.strict, tc.subscribed, b, want)
+			}
+		}
+		if !tc.strict || !tc.subscribed {
+			continue
+		}
+		// Unsubscribing rejects the notifications again.
+		if b := c.request(t, pdu(WriteRequestCode, uint16(0x0006), uint16(0))); !bytes.Equal(b, []byte{WriteResponseCode}) {
+			t.Fatalf("can't unsubscribe: [% X]", b)
+		}
+		if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, []byte{0x01}); err != ErrNotSubscribed {
+			t.Errorf("unsubscribed: got %v, want ErrNotSubscribed", err)
+		}
+	}
+}
+
+// TestEmptyRead checks that intentionally empty values are responded as such,
+// and kept apart from the values missing.
+func TestEmptyRead(t *testing.T) {
+	empty := ble.NewService(ble.UUID16(0xFFF0))
+	empty.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {}))
+	missing := ble.NewService(ble.UUID16(0xFFF2))
+	missing.NewCharacteristic(ble.UUID16(0xFFF3)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		rsp.SetStatus(ble.ErrAttrNotFound)
+	}))
+	unnamed := ble.NewService(ble.GAPUUID)
+	unnamed.AddCharacteristic(DeviceNameCharacteristic(func() string { return "" }))
+	_, c := newTestServer(t, []*ble.Service{empty, missing, unnamed})
+
+	for _, tc := range []struct {
+		name string
+		req  []byte
+		want []byte
+	}{
+		{"empty", pdu(ReadRequestCode, uint16(0x0003)), []byte{ReadResponseCode}},
+		{"empty blob", pdu(ReadBlobRequestCode, uint16(0x0003), uint16(0)), []byte{ReadBlobResponseCode}},
+		{"missing", pdu(ReadRequestCode, uint16(0x0006)), newErrorResponse(ReadRequestCode, 0x0006, ble.ErrAttrNotFound)},
+		{"missing blob", pdu(ReadBlobRequestCode, uint16(0x0006), uint16(0)), newErrorResponse(ReadBlobRequestCode, 0x0006, ble.ErrAttrNotFound)},
+		{"empty name", pdu(ReadRequestCode, uint16(0x0009)), []byte{ReadResponseCode}},
+	} {
+		if b := c.request(t, tc.req); !bytes.Equal(b, tc.want) {
+			t.Errorf("%s: got [% X], want [% X]", tc.name, b, tc.want)
+		}
+	}
+}
+
+func TestExchangeMTUInsuffResources(t *testing.T) {
+	clk := newFakeClock()
+	s, c := newTestServer(t, testServices(), OptClock(clk))
+	// The indication waiting for its confirmation holds the indication buffer.
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.IndicateTimeout(0x0005, []byte{0x01}, 0)
+		errc <- err
+	}()
+	c.recv(t)
+
+	req := pdu(ExchangeMTURequestCode, uint16(100))
+	c.in <- req
+	for clk.pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(maxBufferWait)
+	if b, want := c.recv(t), newErrorResponse(ExchangeMTURequestCode, 0x0000, ble.ErrInsuffResources); !bytes.Equal(b, want) {
+		t.Fatalf("got [% X], want [% X]", b, want)
+	}
+
+	// The client retries once the buffers are released.
+	c.in <- pdu(HandleValueConfirmationCode)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if b, want := c.request(t, req), pdu(ExchangeMTUResponseCode, uint16(ble.MaxMTU)); !bytes.Equal(b, want) {
+		t.Errorf("retry: got [% X], want [% X]", b, want)
+	}
+}
+
+func TestRespondThenNotify(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	cp := svc.NewCharacteristic(ble.UUID16(0xFFF1))
+	cp.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		if err := RespondThenNotify(req, 0x0003, req.Data()); err != nil {
+			t.Error(err)
+		}
+	}))
+	cp.HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {}))
+	svc.NewCharacteristic(ble.UUID16(0xFFF2)).SetValue([]byte{0x42})
+	_, c := newTestServer(t, []*ble.Service{svc})
+
+	for i := 0; i < 10; i++ {
+		// The read queued right behind the write is responded only after
+		// the acknowledging notification.
+		c.in <- pdu(WriteRequestCode, uint16(0x0003), i)
+		c.in <- pdu(ReadRequestCode, uint16(0x0006))
+		for _, want := range [][]byte{
+			{WriteResponseCode},
+			pdu(HandleValueNotificationCode, uint16(0x0003), i),
+			pdu(ReadResponseCode, 0x42),
+		} {
+			if b := c.recv(t); !bytes.Equal(b, want) {
+				t.Fatalf("write %d: got [% X], want [% X]", i, b, want)
+			}
+		}
+	}
+
+	if err := RespondThenNotify(ble.NewRequest(newTestConn(ble.MaxMTU), nil, 0), 0x0003, nil); err != ErrInvalidArgument {
+		t.Errorf("request without a Server: got %v, want ErrInvalidArgument", err)
+	}
+}
+
+func TestRequestQueue(t *testing.T) {
+	release := make(chan struct{})
+	var written []byte
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		if req.Data()[0] == 0 {
+			<-release
+		}
+		written = append(written, req.Data()[0])
+	}))
+	svc.NewCharacteristic(ble.UUID16(0xFFF2)).SetValue([]byte{0x42})
+	s, c := newTestServer(t, []*ble.Service{svc}, OptRequestQueueSize(4))
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.IndicateTimeout(0x0003, []byte{0x01}, 0)
+		errc <- err
+	}()
+	c.recv(t)
+
+	// The slow handler of the first write holds the PDUs that follow, except
+	// for the confirmation, which is processed meanwhile.
+	c.in <- pdu(WriteRequestCode, uint16(0x0003), 0)
+	c.in <- pdu(WriteCommandCode, uint16(0x0003), 1)
+	c.in <- pdu(HandleValueConfirmationCode)
+	c.in <- pdu(WriteCommandCode, uint16(0x0003), 2)
+	c.in <- pdu(ReadRequestCode, uint16(0x0005))
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("confirmation not processed while the handler runs")
+	}
+	select {
+	case b := <-c.out:
+		t.Fatalf("responded [% X] before the handler returned", b)
+	default:
+	}
+
+	// Once released, the PDUs are handled, and responded, in order.
+	close(release)
+	for _, want := range [][]byte{{WriteResponseCode}, pdu(ReadResponseCode, 0x42)} {
+		if b := c.recv(t); !bytes.Equal(b, want) {
+			t.Fatalf("got [% X], want [% X]", b, want)
+		}
+	}
+	if !bytes.Equal(written, []byte{0, 1, 2}) {
+		t.Errorf("written [% X], want [00 01 02]", written)
+	}
+}
+
+// TestCloseDuringNotify is meant to be run with -race.
+func TestCloseDuringNotify(t *testing.T) {
+	s, c := newTestServer(t, testServices())
+	drained := make(chan struct{})
+	defer close(drained)
+	go func() {
+		for {
+			select {
+			case <-c.out:
+			case <-drained:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	sent := make(chan struct{}, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, err := s.NotifyByUUID(false, ble.AppearanceUUID, []byte{0x01})
+				switch err {
+				case nil:
+					select {
+					case sent <- struct{}{}:
+					default:
+					}
+				case ErrServerClosed:
+					return
+				default:
+					t.Errorf("got %v, want ErrServerClosed", err)
+					return
+				}
+			}
+		}()
+	}
+	<-sent
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	// The notifications sent afterwards fail the same way.
+	if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, []byte{0x01}); err != ErrServerClosed {
+		t.Errorf("after the close: got %v, want ErrServerClosed", err)
+	}
+}
+
+// TestReadByTypePaginated reads the values of a proxy, whose backing store is
+// fetched a page of values at a time, at most once per request.
+func TestReadByTypePaginated(t *testing.T) {
+	const pageSize = 2
+	values := [][]byte{{0x00}, {0x01}, {0x02}, {0x03}, {0x04}}
+	page, fetched, fetches := -1, false, 0
+	var ss []*ble.Service
+	for i := range values {
+		i := i
+		svc := ble.NewService(ble.UUID16(0xFFF0))
+		svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			if i/pageSize != page {
+				if fetched {
+					// Not fetched yet; ends the response before this value.
+					rsp.SetStatus(ble.ErrInsuffResources)
+					return
+				}
+				page, fetched = i/pageSize, true
+				fetches++
+			}
+			rsp.Write(values[i])
+		}))
+		ss = append(ss, svc)
+	}
+	s, err := NewServer(NewDB(ss, 1), newTestConn(ble.MaxMTU))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got [][]byte
+	var ends []uint16
+	for start := uint16(0x0001); ; {
+		fetched = false
+		b := s.ProcessRequest(pdu(ReadByTypeRequestCode, start, uint16(0xFFFF), ble.UUID16(0xFFF1)))
+		if b[0] == ErrorResponseCode {
+			if want := newErrorResponse(ReadByTypeRequestCode, start, ble.ErrAttrNotFound); !bytes.Equal(b, want) {
+				t.Fatalf("got [% X], want [% X]", b, want)
+			}
+			break
+		}
+		if b[0] != ReadByTypeResponseCode || b[1] != 3 || (len(b)-2)%3 != 0 {
+			t.Fatalf("malformed response [% X]", b)
+		}
+		// The client resumes from the handle following the last one responded.
+		for e := b[2:]; len(e) != 0; e = e[3:] {
+			got = append(got, e[2:3])
+			start = binary.LittleEndian.Uint16(e) + 1
+		}
+		ends = append(ends, start-1)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(values) {
+		t.Errorf("read %v, want %v", got, values)
+	}
+	// Each response ends with its page.
+	if want := []uint16{0x0006, 0x000C, 0x000F}; fmt.Sprint(ends) != fmt.Sprint(want) {
+		t.Errorf("responses ending at %04X, want %04X", ends, want)
+	}
+	if fetches != 3 {
+		t.Errorf("fetched %d pages, want 3", fetches)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	for _, expire := range []bool{false, true} {
+		entered, release := make(chan struct{}), make(chan struct{})
+		svc := ble.NewService(ble.UUID16(0xFFF0))
+		svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			close(entered)
+			<-release
+			rsp.Write([]byte("slow"))
+		}))
+		s, c := newTestServer(t, []*ble.Service{svc})
+		c.in <- pdu(ReadRequestCode, uint16(0x0003))
+		<-entered
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- s.Shutdown(ctx) }()
+		select {
+		case err := <-errc:
+			t.Fatalf("expire %t: shut down with %v while the handler runs", expire, err)
+		case <-c.closed:
+			t.Fatalf("expire %t: closed while the handler runs", expire)
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		if expire {
+			// The connection is closed without waiting for the response.
+			cancel()
+			if err := <-errc; err != context.Canceled {
+				t.Errorf("got %v, want context.Canceled", err)
+			}
+			<-c.closed
+			close(release)
+			continue
+		}
+		close(release)
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		// The response is sent in full, before the connection is closed.
+		select {
+		case b := <-c.out:
+			if want := pdu(ReadResponseCode, "slow"); !bytes.Equal(b, want) {
+				t.Errorf("got [% X], want [% X]", b, want)
+			}
+		default:
+			t.Error("closed without the response")
+		}
+		<-c.closed
+	}
+}
+
+func TestMaxEntriesPerResponse(t *testing.T) {
+	// Each discovery walks the handles, resuming from the one following the
+	// last one responded, and returns the entries of each response.
+	discover := func(c *testConn, req func(start uint16) []byte) (rsps [][][]byte) {
+		for start := uint16(0x0001); ; {
+			b := c.request(t, req(start))
+			if b[0] == ErrorResponseCode {
+				return rsps
+			}
+			n := int(b[1])
+			if b[0] == FindInformationResponseCode {
+				n = map[byte]int{0x01: 4, 0x02: 18}[b[1]]
+			}
+			var entries [][]byte
+			var last uint16
+			for e := b[2:]; len(e) >= n; e = e[n:] {
+				entries = append(entries, e[:n])
+				last = binary.LittleEndian.Uint16(e)
+				if b[0] == ReadByGroupTypeResponseCode {
+					last = binary.LittleEndian.Uint16(e[2:])
+				}
+			}
+			rsps = append(rsps, entries)
+			if last == 0xFFFF {
+				return rsps
+			}
+			start = last + 1
+		}
+	}
+	// The ATT_MTU is raised for all the entries to fit in a single response.
+	newServer := func(opts ...Option) *testConn {
+		bas := ble.NewService(ble.BatteryUUID)
+		bas.NewCharacteristic(ble.BatteryLevelUUID).SetValue([]byte{99})
+		_, c := newTestServer(t, append(testServices()[:1], bas), opts...)
+		c.request(t, pdu(ExchangeMTURequestCode, uint16(100)))
+		return c
+	}
+	for _, tc := range []struct {
+		name string
+		req  func(start uint16) []byte
+	}{
+		{"Find Information", func(start uint16) []byte {
+			return pdu(FindInformationRequestCode, start, uint16(0xFFFF))
+		}},
+		{"Read By Type", func(start uint16) []byte {
+			return pdu(ReadByTypeRequestCode, start, uint16(0xFFFF), ble.CharacteristicUUID)
+		}},
+		{"Read By Group Type", func(start uint16) []byte {
+			return pdu(ReadByGroupTypeRequestCode, start, uint16(0xFFFF), ble.PrimaryServiceUUID)
+		}},
+	} {
+		rsps := discover(newServer(), tc.req)
+		if len(rsps) != 1 {
+			t.Fatalf("%s: %d responses uncapped, want 1", tc.name, len(rsps))
+		}
+		all := rsps[0]
+		for _, max := range []int{1, 2} {
+			rsps := discover(newServer(OptMaxEntriesPerResponse(max)), tc.req)
+			if want := (len(all) + max - 1) / max; len(rsps) != want {
+				t.Errorf("%s, max %d: %d responses, want %d", tc.name, max, len(rsps), want)
+			}
+			var entries [][]byte
+			for _, r := range rsps {
+				if len(r) > max {
+					t.Errorf("%s, max %d: response of %d entries", tc.name, max, len(r))
+				}
+				entries = append(entries, r...)
+			}
+			if fmt.Sprint(entries) != fmt.Sprint(all) {
+				t.Errorf("%s, max %d: discovered %X, want %X", tc.name, max, entries, all)
+			}
+		}
+	}
+}
+
+func TestReadByGroupTypeForms(t *testing.T) {
+	_, c := newTestServer(t, testServices())
+	want := pdu(ReadByGroupTypeResponseCode, 6, uint16(0x0001), uint16(0x0006), ble.GAPUUID)
+	for _, tc := range []struct {
+		name string
+		typ  ble.UUID
+		want []byte
+	}{
+		{"16-bit Primary Service", ble.PrimaryServiceUUID, want},
+		{"128-bit Primary Service", ble.MustParse("00002800-0000-1000-8000-00805F9B34FB"), want},
+		{"16-bit Secondary Service", ble.SecondaryServiceUUID, newErrorResponse(ReadByGroupTypeRequestCode, 0x0001, ble.ErrAttrNotFound)},
+		{"128-bit Secondary Service", ble.MustParse("00002801-0000-1000-8000-00805F9B34FB"), newErrorResponse(ReadByGroupTypeRequestCode, 0x0001, ble.ErrAttrNotFound)},
+		{"16-bit Characteristic", ble.CharacteristicUUID, newErrorResponse(ReadByGroupTypeRequestCode, 0x0001, ble.ErrUnsuppGrpType)},
+		{"128-bit Characteristic", ble.MustParse("00002803-0000-1000-8000-00805F9B34FB"), newErrorResponse(ReadByGroupTypeRequestCode, 0x0001, ble.ErrUnsuppGrpType)},
+		{"Primary Service off the Base UUID", ble.MustParse("00002800-0000-1000-8000-00805F9B34FC"), newErrorResponse(ReadByGroupTypeRequestCode, 0x0001, ble.ErrUnsuppGrpType)},
+		{"custom", ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7"), newErrorResponse(ReadByGroupTypeRequestCode, 0x0001, ble.ErrUnsuppGrpType)},
+	} {
+		if b := c.request(t, pdu(ReadByGroupTypeRequestCode, uint16(0x0001), uint16(0x0006), tc.typ)); !bytes.Equal(b, tc.want) {
+			t.Errorf("%s: got [% X], want [% X]", tc.name, b, tc.want)
+		}
+	}
+}
+
+func TestReadByTypeVaryingLength(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		// Each value grows by a byte every time it's read, and the third
+		// one starts a byte longer than the others.
+		var mu sync.Mutex
+		reads := make([]int, 4)
+		var ss []*ble.Service
+		for i := range reads {
+			i := i
+			svc := ble.NewService(ble.UUID16(0xFFF0))
+			svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+				mu.Lock()
+				defer mu.Unlock()
+				n := 1 + reads[i]
+				if i == 2 {
+					n++
+				}
+				reads[i]++
+				rsp.Write(bytes.Repeat([]byte{byte(i)}, n))
+			}))
+			ss = append(ss, svc)
+		}
+		_, c := newTestServer(t, ss, func(s *Server) error { s.HandlerConcurrency = concurrency; return nil })
+		req := func(start uint16) []byte {
+			return c.request(t, pdu(ReadByTypeRequestCode, start, uint16(0xFFFF), ble.UUID16(0xFFF1)))
+		}
+
+		// The value of another length ends the response, rather than being
+		// truncated, padded, or skipped.
+		if b, want := req(0x0001), pdu(ReadByTypeResponseCode, 3, uint16(0x0003), 0x00, uint16(0x0006), 0x01); !bytes.Equal(b, want) {
+			t.Errorf("concurrency %d: got [% X], want [% X]", concurrency, b, want)
+		}
+		// The client resumes from it, which is read again, now 3 bytes long.
+		if b, want := req(0x0007), pdu(ReadByTypeResponseCode, 5, uint16(0x0009), []byte{0x02, 0x02, 0x02}); !bytes.Equal(b, want) {
+			t.Errorf("concurrency %d: got [% X], want [% X]", concurrency, b, want)
+		}
+		// Each value is read once per request, so its length matches the one
+		// of the entry, however many times it has been read before.
+		b := req(0x000A)
+		if len(b) < 5 || b[0] != ReadByTypeResponseCode || int(b[1]) != len(b)-2 ||
+			!bytes.Equal(b[2:4], pdu(uint16(0x000C))) || !bytes.Equal(b[4:], bytes.Repeat([]byte{0x03}, len(b)-4)) {
+			t.Errorf("concurrency %d: malformed response [% X]", concurrency, b)
+		}
+	}
+}
+
+func TestMaxErrorRate(t *testing.T) {
+	clk := newFakeClock()
+	s, err := NewServer(NewDB(testServices(), 1), newTestConn(ble.MaxMTU))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Option(OptClock(clk), OptMaxErrorRate(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := pdu(ReadRequestCode, uint16(0x0100))
+	good := pdu(ReadRequestCode, uint16(0x0009))
+	flood := func() (responded int) {
+		for i := 0; i < 20; i++ {
+			if b := s.ProcessRequest(bad); b != nil {
+				responded++
+			}
+			// The valid requests are unaffected by the limiter.
+			if b := s.ProcessRequest(good); !bytes.Equal(b, pdu(ReadResponseCode, 99)) {
+				t.Fatalf("valid request responded [% X]", b)
+			}
+		}
+		return responded
+	}
+	if n := flood(); n != 5 {
+		t.Errorf("%d errors responded, want 5", n)
+	}
+	if n := s.DroppedRequests(); n != 15 {
+		t.Errorf("%d requests dropped, want 15", n)
+	}
+	// The errors dropped are counted still.
+	if n := s.ErrorCounts()[ble.ErrInvalidHandle]; n != 20 {
+		t.Errorf("%d ErrInvalidHandle counted, want 20", n)
+	}
+
+	// The limit applies per second.
+	clk.Advance(time.Second)
+	if n := flood(); n != 5 {
+		t.Errorf("%d errors responded in the next second, want 5", n)
+	}
+	if n := s.DroppedRequests(); n != 30 {
+		t.Errorf("%d requests dropped, want 30", n)
+	}
+}
+
+func TestOpcodeFlags(t *testing.T) {
+	var written []byte
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		written = append(written, req.Data()...)
+	}))
+	s, err := NewServer(NewDB([]*ble.Service{svc}, 1), newTestConn(ble.MaxMTU))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := make([]byte, 12)
+	for _, tc := range []struct {
+		name    string
+		req     []byte
+		rsp     []byte
+		written []byte
+	}{
+		{"write request", pdu(WriteRequestCode, uint16(0x0003), 0x01), pdu(WriteResponseCode), []byte{0x01}},
+		{"write command", pdu(WriteCommandCode, uint16(0x0003), 0x02), nil, []byte{0x02}},
+		// Signed Write Commands are not supported, and ignored as commands.
+		{"signed write command", pdu(SignedWriteCommandCode, uint16(0x0003), 0x03, signature), nil, nil},
+		// Requests can't be signed.
+		{"signed write request", pdu(WriteRequestCode|sigFlag, uint16(0x0003), 0x04), newErrorResponse(WriteRequestCode|sigFlag, 0x0000, ble.ErrInvalidPDU), nil},
+		{"signed read request", pdu(ReadRequestCode|sigFlag, uint16(0x0003)), newErrorResponse(ReadRequestCode|sigFlag, 0x0000, ble.ErrInvalidPDU), nil},
+		// The Command Flag makes an unknown command of a request, which is ignored.
+		{"read command", pdu(ReadRequestCode|cmdFlag, uint16(0x0003)), nil, nil},
+		{"unknown request", pdu(0x3F, uint16(0x0003)), newErrorResponse(0x3F, 0x0000, ble.ErrReqNotSupp), nil},
+	} {
+		written = nil
+		if b := s.ProcessRequest(tc.req); !bytes.Equal(b, tc.rsp) {
+			t.Errorf("%s: responded [% X], want [% X]", tc.name, b, tc.rsp)
+		}
+		if !bytes.Equal(written, tc.written) {
+			t.Errorf("%s: written [% X], want [% X]", tc.name, written, tc.written)
+		}
+	}
+}
+
+func TestNotifyDuringMTUExchange(t *testing.T) {
+	const mtu, n = 100, 200
+	s, c := newTestServer(t, testServices())
+
+	errc := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, make([]byte, ble.MaxMTU)); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- nil
+	}()
+
+	// The notifications sent before the Exchange MTU Response are of the
+	// default ATT_MTU, and the ones sent after it are of the new one.
+	exchanged := false
+	for i := 0; i < n+1; i++ {
+		if i == n/4 {
+			c.in <- pdu(ExchangeMTURequestCode, uint16(mtu))
+		}
+		b := c.recv(t)
+		switch {
+		case b[0] == ExchangeMTUResponseCode:
+			exchanged = true
+		case b[0] != HandleValueNotificationCode:
+			t.Fatalf("unexpected PDU [% X]", b)
+		case !exchanged && len(b) != ble.DefaultMTU:
+			t.Fatalf("notification of %d bytes before the exchange, want %d", len(b), ble.DefaultMTU)
+		case exchanged && len(b) != mtu:
+			t.Fatalf("notification of %d bytes after the exchange, want %d", len(b), mtu)
+		}
+	}
+	if !exchanged {
+		t.Fatal("Exchange MTU Request not responded")
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWireUUID(t *testing.T) {
+	for _, tc := range []struct {
+		u, want ble.UUID
+	}{
+		{ble.UUID16(0x2A00), ble.UUID16(0x2A00)},
+		{ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7"), ble.MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7")},
+		{ble.UUID{0x78, 0x56, 0x34, 0x12}, ble.MustParse("12345678-0000-1000-8000-00805F9B34FB")},
+		{ble.UUID{0x01, 0x02, 0x03}, nil},
+		{nil, nil},
+	} {
+		if u := wireUUID(tc.u); !bytes.Equal(u, tc.want) {
+			t.Errorf("wireUUID(% X) = % X, want % X", []byte(tc.u), []byte(u), []byte(tc.want))
+		}
+	}
+}
+
+func TestFindInformation32BitUUID(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	u32 := ble.UUID{0x78, 0x56, 0x34, 0x12}
+	svc.NewCharacteristic(u32).SetValue([]byte{0x01})
+	svc.NewCharacteristic(ble.UUID16(0xFFF2)).SetValue([]byte{0x02})
+	db := NewDB([]*ble.Service{svc}, 1)
+	// The type of 0x0005 can't be carried in any format.
+	a, _ := db.at(0x0005)
+	a.typ = ble.UUID{0x01, 0x02, 0x03}
+	db.index()
+	s, err := NewServer(db, newTestConn(ble.MaxMTU))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		start, end uint16
+		want       []byte
+	}{
+		// The 32-bit type ends the response of 16-bit ones.
+		{0x0001, 0x0005, pdu(FindInformationResponseCode, 0x01, uint16(0x0001), ble.PrimaryServiceUUID, uint16(0x0002), ble.CharacteristicUUID)},
+		// And is responded in the 128-bit form.
+		{0x0003, 0x0005, pdu(FindInformationResponseCode, 0x02, uint16(0x0003), ble.MustParse("12345678-0000-1000-8000-00805F9B34FB"))},
+		// Types of other lengths are skipped.
+		{0x0004, 0x0005, pdu(FindInformationResponseCode, 0x01, uint16(0x0004), ble.CharacteristicUUID)},
+		{0x0005, 0x0005, newErrorResponse(FindInformationRequestCode, 0x0005, ble.ErrAttrNotFound)},
+	} {
+		if b := s.ProcessRequest(pdu(FindInformationRequestCode, tc.start, tc.end)); !bytes.Equal(b, tc.want) {
+			t.Errorf("[0x%04X, 0x%04X]: got [% X], want [% X]", tc.start, tc.end, b, tc.want)
+		}
+	}
+}
+
+func TestRequireMTUExchange(t *testing.T) {
+	newServer := func(gated bool) (*Server, *int) {
+		var written int
+		svc := ble.NewService(ble.UUID16(0xFFF0))
+		c := svc.NewCharacteristic(ble.UUID16(0xFFF1))
+		c.SetValue([]byte{0x01})
+		svc.NewCharacteristic(ble.UUID16(0xFFF2)).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			written++
+		}))
+		s, err := NewServer(NewDB([]*ble.Service{svc}, 1), newTestConn(ble.MaxMTU))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gated {
+			s.RequireMTUExchange(ReadRequestCode, ble.ErrInsuffResources)
+			s.RequireMTUExchange(WriteCommandCode, ble.ErrInsuffResources)
+		}
+		return s, &written
+	}
+	read := pdu(ReadRequestCode, uint16(0x0003))
+	write := pdu(WriteCommandCode, uint16(0x0005), 0x01)
+	group := pdu(ReadByGroupTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.PrimaryServiceUUID)
+	exchange := pdu(ExchangeMTURequestCode, uint16(ble.MaxMTU))
+
+	t.Run("not gated", func(t *testing.T) {
+		s, written := newServer(false)
+		if b := s.ProcessRequest(read); !bytes.Equal(b, pdu(ReadResponseCode, 0x01)) {
+			t.Errorf("read: got [% X]", b)
+		}
+		s.ProcessRequest(write)
+		if *written != 1 {
+			t.Errorf("%d commands handled, want 1", *written)
+		}
+	})
+
+	t.Run("gated", func(t *testing.T) {
+		s, written := newServer(true)
+		if b, want := s.ProcessRequest(read), newErrorResponse(ReadRequestCode, 0x0000, ble.ErrInsuffResources); !bytes.Equal(b, want) {
+			t.Errorf("read before the exchange: got [% X], want [% X]", b, want)
+		}
+		if b := s.ProcessRequest(write); b != nil || *written != 0 {
+			t.Errorf("command before the exchange: responded [% X], %d handled", b, *written)
+		}
+		// The opcodes not gated are handled anyway.
+		if b := s.ProcessRequest(group); b[0] != ReadByGroupTypeResponseCode {
+			t.Errorf("discovery before the exchange: got [% X]", b)
+		}
+
+		if b := s.ProcessRequest(exchange); b[0] != ExchangeMTUResponseCode {
+			t.Fatalf("exchange: got [% X]", b)
+		}
+		if !s.MTUExchanged() {
+			t.Fatal("MTU not exchanged")
+		}
+		if b := s.ProcessRequest(read); !bytes.Equal(b, pdu(ReadResponseCode, 0x01)) {
+			t.Errorf("read after the exchange: got [% X]", b)
+		}
+		s.ProcessRequest(write)
+		if *written != 1 {
+			t.Errorf("%d commands handled after the exchange, want 1", *written)
+		}
+	})
+
+	t.Run("gate removed", func(t *testing.T) {
+		s, _ := newServer(true)
+		s.RequireMTUExchange(ReadRequestCode, ble.ErrSuccess)
+		if b := s.ProcessRequest(read); !bytes.Equal(b, pdu(ReadResponseCode, 0x01)) {
+			t.Errorf("read: got [% X]", b)
+		}
+	})
+}
+
+// newWriteServer returns a Server, which isn't looping, with two writable
+// characteristic values at 0x0003 and 0x0005, which record the values
+// written to them.
+func newWriteServer(t *testing.T) (*Server, map[uint16][]byte) {
+	written := map[uint16][]byte{}
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	for _, u := range []uint16{0xFFF1, 0xFFF2} {
+		svc.NewCharacteristic(ble.UUID16(u)).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			h := req.(ble.AttributeRequest).Handle()
+			written[h] = append([]byte{}, req.Data()...)
+		}))
+	}
+	s, err := NewServer(NewDB([]*ble.Service{svc}, 1), newTestConn(ble.MaxMTU))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, written
+}
+
+func TestExecuteWritesOffsets(t *testing.T) {
+	type part struct {
+		h   uint16
+		off uint16
+		v   string
+	}
+	for _, tc := range []struct {
+		name   string
+		parts  []part
+		strict bool
+		h      uint16 // Handle in error, if any.
+		e      ble.ATTError
+		want   string // Value written to 0x0003.
+	}{
+		{"in order", []part{{3, 0, "abc"}, {3, 3, "de"}}, false, 0, ble.ErrSuccess, "abcde"},
+		{"in order, strict", []part{{3, 0, "abc"}, {3, 3, "de"}}, true, 0, ble.ErrSuccess, "abcde"},
+		// The parts are sorted by the offsets in the strict mode.
+		{"out of order", []part{{3, 3, "de"}, {3, 0, "abc"}}, false, 3, ble.ErrInvalidOffset, ""},
+		{"out of order, strict", []part{{3, 3, "de"}, {3, 0, "abc"}}, true, 0, ble.ErrSuccess, "abcde"},
+		// Overlapping parts overwrite the previous ones in the permissive mode.
+		{"overlap", []part{{3, 0, "abcd"}, {3, 2, "XY"}}, false, 0, ble.ErrSuccess, "abXY"},
+		{"overlap, strict", []part{{3, 0, "abcd"}, {3, 2, "XY"}}, true, 3, ble.ErrInvalidOffset, ""},
+		{"gap", []part{{3, 0, "ab"}, {3, 3, "d"}}, false, 3, ble.ErrInvalidOffset, ""},
+		{"gap, strict", []part{{3, 0, "ab"}, {3, 3, "d"}}, true, 3, ble.ErrInvalidOffset, ""},
+		// The handle in error is the one whose parts are invalid.
+		{"gap in the second value, strict", []part{{3, 0, "ab"}, {5, 1, "b"}}, true, 5, ble.ErrInvalidOffset, ""},
+		{"not from 0, strict", []part{{3, 1, "bc"}}, true, 3, ble.ErrInvalidOffset, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, written := newWriteServer(t)
+			s.StrictPrepareWrites = tc.strict
+			for _, p := range tc.parts {
+				if b := s.ProcessRequest(pdu(PrepareWriteRequestCode, p.h, p.off, p.v)); b[0] != PrepareWriteResponseCode {
+					t.Fatalf("prepare: got [% X]", b)
+				}
+			}
+			want := pdu(ExecuteWriteResponseCode)
+			if tc.e != ble.ErrSuccess {
+				want = newErrorResponse(ExecuteWriteRequestCode, tc.h, tc.e)
+			}
+			if b := s.ProcessRequest(pdu(ExecuteWriteRequestCode, 0x01)); !bytes.Equal(b, want) {
+				t.Errorf("execute: got [% X], want [% X]", b, want)
+			}
+			if v := written[0x0003]; string(v) != tc.want {
+				t.Errorf("written %q, want %q", v, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadMultipleBoundary(t *testing.T) {
+	// Four values of n bytes, the odd ones static, and the even ones dynamic,
+	// at 0x0003, 0x0005, 0x0007 and 0x0009.
+	newServer := func(n int) *Server {
+		svc := ble.NewService(ble.UUID16(0xFFF0))
+		for i := 0; i < 4; i++ {
+			v := bytes.Repeat([]byte{byte('a' + i)}, n)
+			c := svc.NewCharacteristic(ble.UUID16(0xFFF1 + uint16(i)))
+			if i%2 == 0 {
+				c.SetValue(v)
+				continue
+			}
+			c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) { rsp.Write(v) }))
+		}
+		s, err := NewServer(NewDB([]*ble.Service{svc}, 1), newTestConn(ble.MaxMTU))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	req := pdu(ReadMultipleRequestCode, uint16(0x0003), uint16(0x0005), uint16(0x0007), uint16(0x0009))
+
+	// The 22 bytes of the response of the default ATT_MTU end in the middle
+	// of the third value, which is the only one truncated.
+	if b, want := newServer(8).ProcessRequest(req), pdu(ReadMultipleResponseCode, "aaaaaaaa", "bbbbbbbb", "cccccc"); !bytes.Equal(b, want) {
+		t.Errorf("mid-value: got [% X], want [% X]", b, want)
+	}
+	// Or at the end of the second value, with nothing truncated.
+	if b, want := newServer(11).ProcessRequest(req), pdu(ReadMultipleResponseCode, "aaaaaaaaaaa", "bbbbbbbbbbb"); !bytes.Equal(b, want) {
+		t.Errorf("value boundary: got [% X], want [% X]", b, want)
+	}
+	// Or in the middle of the first value.
+	if b, want := newServer(30).ProcessRequest(req), pdu(ReadMultipleResponseCode, bytes.Repeat([]byte{'a'}, 22)); !bytes.Equal(b, want) {
+		t.Errorf("first value: got [% X], want [% X]", b, want)
+	}
+}
+
+func TestAuditHook(t *testing.T) {
+	type access struct {
+		op byte
+		h  uint16
+		v  string
+	}
+	var got []access
+	s, err := NewServer(NewDB(testServices(), 1), newTestConn(ble.MaxMTU))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AuditHook = func(conn ble.Conn, op byte, h uint16, v []byte) {
+		got = append(got, access{op, h, string(v)})
+	}
+
+	for _, tc := range []struct {
+		req  []byte
+		rsp  []byte
+		want []access
+	}{
+		{pdu(ReadRequestCode, uint16(0x0003)), pdu(ReadResponseCode, "Gopher"),
+			[]access{{ReadRequestCode, 0x0003, "Gopher"}}},
+		{pdu(ReadRequestCode, uint16(0x0005)), pdu(ReadResponseCode, 0x01, 0x02),
+			[]access{{ReadRequestCode, 0x0005, "\x01\x02"}}},
+		{pdu(ReadBlobRequestCode, uint16(0x0003), uint16(2)), pdu(ReadBlobResponseCode, "pher"),
+			[]access{{ReadBlobRequestCode, 0x0003, "pher"}}},
+		{pdu(ReadMultipleRequestCode, uint16(0x0003), uint16(0x0009)), pdu(ReadMultipleResponseCode, "Gopher", 99),
+			[]access{{ReadMultipleRequestCode, 0x0003, "Gopher"}, {ReadMultipleRequestCode, 0x0009, "c"}}},
+		{pdu(WriteRequestCode, uint16(0x0005), "on"), pdu(WriteResponseCode),
+			[]access{{WriteRequestCode, 0x0005, "on"}}},
+		{pdu(WriteCommandCode, uint16(0x0005), "off"), nil,
+			[]access{{WriteCommandCode, 0x0005, "off"}}},
+		// The parts prepared are audited once they're written.
+		{pdu(PrepareWriteRequestCode, uint16(0x0005), uint16(0), "lo"), pdu(PrepareWriteResponseCode, uint16(0x0005), uint16(0), "lo"), nil},
+		{pdu(PrepareWriteRequestCode, uint16(0x0005), uint16(2), "ng"), pdu(PrepareWriteResponseCode, uint16(0x0005), uint16(2), "ng"), nil},
+		{pdu(ExecuteWriteRequestCode, 0x01), pdu(ExecuteWriteResponseCode),
+			[]access{{ExecuteWriteRequestCode, 0x0005, "long"}}},
+		// Neither failures nor discoveries are audited.
+		{pdu(ReadRequestCode, uint16(0x0010)), newErrorResponse(ReadRequestCode, 0x0010, ble.ErrInvalidHandle), nil},
+		{pdu(WriteRequestCode, uint16(0x0003), "x"), newErrorResponse(WriteRequestCode, 0x0003, ble.ErrWriteNotPerm), nil},
+		{pdu(ReadByTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.DeviceNameUUID), pdu(ReadByTypeResponseCode, 8, uint16(0x0003), "Gopher"), nil},
+	} {
+		got = nil
+		if b := s.ProcessRequest(tc.req); !bytes.Equal(b, tc.rsp) {
+			t.Errorf("[% X]: responded [% X], want [% X]", tc.req, b, tc.rsp)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("[% X]: audited %v, want %v", tc.req, got, tc.want)
+		}
+	}
+}
+
+// vectoredTestConn is a testConn, which supports vectored IO.
+type vectoredTestConn struct {
+	*testConn
+}
+
+func (c *vectoredTestConn) WriteBuffers(v [][]byte) (int, error) {
+	return c.Write(bytes.Join(v, nil))
+}
+
+func TestResponseInterceptor(t *testing.T) {
+	type exchange struct{ req, rsp []byte }
+	seen := make(chan exchange, 3)
+	c := newTestConn(ble.MaxMTU)
+	s, err := NewServer(NewDB(testServices(), 1), &vectoredTestConn{c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ResponseInterceptor = func(req, rsp []byte) []byte {
+		seen <- exchange{append([]byte{}, req...), append([]byte{}, rsp...)}
+		switch binary.LittleEndian.Uint16(req[1:]) {
+		case 0x0009:
+			return nil
+		case 0x0005:
+			return newErrorResponse(ReadRequestCode, 0x0005, ble.ErrReadNotPerm)
+		}
+		return rsp
+	}
+	go s.Loop()
+	<-s.Started()
+	defer c.Close()
+
+	// The Battery Level is suppressed, so the next PDU sent is the
+	// replacement of the response of the Appearance.
+	c.in <- pdu(ReadRequestCode, uint16(0x0009))
+	if b, want := c.request(t, pdu(ReadRequestCode, uint16(0x0005))), newErrorResponse(ReadRequestCode, 0x0005, ble.ErrReadNotPerm); !bytes.Equal(b, want) {
+		t.Errorf("got [% X], want [% X]", b, want)
+	}
+	// The static Device Name is sent as the rspTail, which is still
+	// passed to the interceptor as a part of the response.
+	if b, want := c.request(t, pdu(ReadRequestCode, uint16(0x0003))), pdu(ReadResponseCode, "Gopher"); !bytes.Equal(b, want) {
+		t.Errorf("got [% X], want [% X]", b, want)
+	}
+
+	for _, want := range []exchange{
+		{pdu(ReadRequestCode, uint16(0x0009)), pdu(ReadResponseCode, 99)},
+		{pdu(ReadRequestCode, uint16(0x0005)), pdu(ReadResponseCode, 0x01, 0x02)},
+		{pdu(ReadRequestCode, uint16(0x0003)), pdu(ReadResponseCode, "Gopher")},
+	} {
+		if e := <-seen; !bytes.Equal(e.req, want.req) || !bytes.Equal(e.rsp, want.rsp) {
+			t.Errorf("intercepted [% X] [% X], want [% X] [% X]", e.req, e.rsp, want.req, want.rsp)
+		}
+	}
+}
+
+func TestExecuteWritesCommitError(t *testing.T) {
+	const failed = 0x0007
+	var written []uint16
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	for i := 0; i < 4; i++ {
+		svc.NewCharacteristic(ble.UUID16(0xFFF1 + uint16(i))).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			h := req.(ble.AttributeRequest).Handle()
+			if h == failed {
+				rsp.SetStatus(ble.ErrUnlikely)
+				return
+			}
+			written = append(written, h)
+		}))
+	}
+	s, err := NewServer(NewDB([]*ble.Service{svc}, 1), newTestConn(ble.MaxMTU))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range []uint16{0x0003, 0x0005, 0x0007, 0x0009} {
+		if b := s.ProcessRequest(pdu(PrepareWriteRequestCode, h, uint16(0), "v")); b[0] != PrepareWriteResponseCode {
+			t.Fatalf("prepare 0x%04X: got [% X]", h, b)
+		}
+	}
+	if b, want := s.ProcessRequest(pdu(ExecuteWriteRequestCode, 0x01)), newErrorResponse(ExecuteWriteRequestCode, failed, ble.ErrUnlikely); !bytes.Equal(b, want) {
+		t.Errorf("execute: got [% X], want [% X]", b, want)
+	}
+	// The commit is best-effort: the values before the failed one are
+	// written, and the ones after it are not.
+	if fmt.Sprint(written) != fmt.Sprint([]uint16{0x0003, 0x0005}) {
+		t.Errorf("written % X, want [3 5]", written)
+	}
+
+	// The queue is cleared, so nothing is left to be written.
+	if pp := s.PreparedWrites(); len(pp) != 0 {
+		t.Errorf("%d writes left in the queue", len(pp))
+	}
+	written = nil
+	if b := s.ProcessRequest(pdu(ExecuteWriteRequestCode, 0x01)); !bytes.Equal(b, pdu(ExecuteWriteResponseCode)) {
+		t.Errorf("execute again: got [% X]", b)
+	}
+	if len(written) != 0 {
+		t.Errorf("written % X again", written)
+	}
+}
+
+func TestAdvertisedRxMTU(t *testing.T) {
+	const advertised = 100
+	s, c := newTestServer(t, testServices(), OptAdvertisedRxMTU(advertised))
+
+	if b, want := c.request(t, pdu(ExchangeMTURequestCode, uint16(ble.MaxMTU))), pdu(ExchangeMTUResponseCode, uint16(advertised)); !bytes.Equal(b, want) {
+		t.Fatalf("got [% X], want [% X]", b, want)
+	}
+	// The ATT_MTU is the advertised one.
+	if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, make([]byte, ble.MaxMTU)); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.recv(t); len(b) != advertised {
+		t.Errorf("notification of %d bytes, want %d", len(b), advertised)
+	}
+	// While PDUs beyond it are still received.
+	if b := c.request(t, pdu(WriteRequestCode, uint16(0x0005), make([]byte, 2*advertised))); !bytes.Equal(b, pdu(WriteResponseCode)) {
+		t.Errorf("oversized write: got [% X]", b)
+	}
+
+	for _, mtu := range []int{ble.DefaultMTU - 1, ble.MaxMTU + 1} {
+		if err := s.Option(OptAdvertisedRxMTU(mtu)); err != ErrInvalidArgument {
+			t.Errorf("OptAdvertisedRxMTU(%d): got %v, want %v", mtu, err, ErrInvalidArgument)
+		}
+	}
+}
+
+func TestOverLengthPDU(t *testing.T) {
+	var written [][]byte
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		written = append(written, append([]byte{}, req.Data()...))
+	}))
+	c := newTestConn(ble.DefaultMTU)
+	s, err := NewServer(NewDB([]*ble.Service{svc}, 1), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := make(chan int, 4)
+	s.OnRead = func(n int, pdu []byte) { reads <- n }
+	go s.Loop()
+	defer c.Close()
+
+	// A transport delivering more than the rxMTU in a single read.
+	long := make([]byte, 2*ble.DefaultMTU)
+	if b, want := c.request(t, pdu(WriteRequestCode, uint16(0x0003), long)), newErrorResponse(WriteRequestCode, 0x0000, ble.ErrInvalidPDU); !bytes.Equal(b, want) {
+		t.Errorf("got [% X], want [% X]", b, want)
+	}
+	if n := <-reads; n != ble.DefaultMTU+1 {
+		t.Errorf("OnRead reported %d bytes, want %d", n, ble.DefaultMTU+1)
+	}
+	// Over-length commands are dropped silently.
+	c.in <- pdu(WriteCommandCode, uint16(0x0003), long)
+	<-reads
+
+	// Neither of them is passed to the handler, which gets the next write.
+	if b := c.request(t, pdu(WriteRequestCode, uint16(0x0003), "ok")); !bytes.Equal(b, pdu(WriteResponseCode)) {
+		t.Errorf("got [% X]", b)
+	}
+	if len(written) != 1 || string(written[0]) != "ok" {
+		t.Errorf("written %q, want [ok]", written)
+	}
+}
+
+func TestWriteCommandValue(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cmd     []byte
+		written bool
+		want    string
+	}{
+		{"empty", pdu(WriteCommandCode, uint16(0x0003)), true, ""},
+		{"one byte", pdu(WriteCommandCode, uint16(0x0003), 0x01), true, "\x01"},
+		{"value", pdu(WriteCommandCode, uint16(0x0003), "value"), true, "value"},
+		{"malformed", pdu(WriteCommandCode, 0x03), false, ""},
+	} {
+		s, written := newWriteServer(t)
+		if b := s.ProcessRequest(tc.cmd); b != nil {
+			t.Errorf("%s: responded [% X]", tc.name, b)
+		}
+		v, ok := written[0x0003]
+		if ok != tc.written || string(v) != tc.want {
+			t.Errorf("%s: written %q (%t), want %q (%t)", tc.name, v, ok, tc.want, tc.written)
+		}
+	}
+}
+
+// discardConn is a testConn, which reports the length of each PDU sent,
+// without keeping it.
+type discardConn struct {
+	*testConn
+	sent chan int
+}
+
+func (c *discardConn) Write(b []byte) (int, error) {
+	c.sent <- len(b)
+	return len(b), nil
+}
+
+// vectorConn is a discardConn, which supports vectored IO.
+type vectorConn struct {
+	*discardConn
+}
+
+func (c *vectorConn) WriteBuffers(v [][]byte) (int, error) {
+	n := 0
+	for _, b := range v {
+		n += len(b)
+	}
+	c.sent <- n
+	return n, nil
+}
+
+func BenchmarkReadLargeValue(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		vector bool
+	}{{"Copy", false}, {"Vectored", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			s := ble.NewService(ble.BatteryUUID)
+			s.NewCharacteristic(ble.UUID16(0x2A77)).SetValue(make([]byte, ble.MaxMTU-1))
+			dc := &discardConn{testConn: newTestConn(ble.MaxMTU), sent: make(chan int, 1)}
+			var c ble.Conn = dc
+			if bc.vector {
+				c = &vectorConn{dc}
+			}
+			svr, err := NewServer(NewDB([]*ble.Service{s}, 1), c)
+			if err != nil {
+				b.Fatal(err)
+			}
+			go svr.Loop()
+			defer dc.Close()
+
+			dc.in <- pdu(ExchangeMTURequestCode, uint16(ble.MaxMTU))
+			<-dc.sent
+			req := pdu(ReadRequestCode, uint16(0x0003))
+			b.ReportAllocs()
+			b.SetBytes(ble.MaxMTU - 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				dc.in <- req
+				if n := <-dc.sent; n != ble.MaxMTU {
+					b.Fatalf("sent %d bytes, want %d", n, ble.MaxMTU)
+				}
+			}
+		})
+	}
+}
+
+// newCommandServer returns a Server, which isn't looping, with a writable
+// characteristic value at 0x0003 for the Write Commands.
+func newCommandServer(tb testing.TB) *Server {
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	var n int
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		n += len(req.Data())
+	}))
+	s, err := NewServer(NewDB([]*ble.Service{svc}, 1), newTestConn(ble.MaxMTU))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return s
+}
+
+func TestWriteCommandAllocs(t *testing.T) {
+	s := newCommandServer(t)
+	cmd := pdu(WriteCommandCode, uint16(0x0003), []byte{0x01, 0x02, 0x03, 0x04})
+	if n := testing.AllocsPerRun(100, func() { s.ProcessRequest(cmd) }); n != 0 {
+		t.Errorf("%v allocations per Write Command, want 0", n)
+	}
+}
+
+func BenchmarkWriteCommand(b *testing.B) {
+	s := newCommandServer(b)
+	cmd := pdu(WriteCommandCode, uint16(0x0003), make([]byte, 20))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(cmd)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.ProcessRequest(cmd)
+	}
+}
+
+// BenchmarkDiscovery measures the discovery of the services of a
+// 200-attribute DB, with and without the index of attributes by types.
+func BenchmarkDiscovery(b *testing.B) {
+	var ss []*ble.Service
+	for i := 0; i < 40; i++ {
+		s := ble.NewService(ble.UUID16(0x1800 + uint16(i%10)))
+		s.NewCharacteristic(ble.UUID16(0x2A00)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			rsp.Write([]byte{0x00})
+		}))
+		s.NewCharacteristic(ble.UUID16(0x2A01)).SetValue([]byte{0x00})
+		ss = append(ss, s)
+	}
+
+	// discover issues the requests built by next, from handle 0x0001 till
+	// an Error Response, or the end of the last handle range found.
+	discover := func(s *Server, next func(start uint16) []byte, end func(rsp []byte) uint16) {
+		for start := uint16(0x0001); ; {
+			rsp := s.ProcessRequest(next(start))
+			if rsp[0] == ErrorResponseCode {
+				return
+			}
+			e := end(rsp)
+			if e == 0xFFFF {
+				return
+			}
+			start = e + 1
+		}
+	}
+	for _, bc := range []struct {
+		name    string
+		indexed bool
+	}{{"Indexed", true}, {"Linear", false}} {
+		db := NewDB(ss, 1)
+		if len(db.attrs) != 200 {
+			b.Fatalf("%d attributes, want 200", len(db.attrs))
+		}
+		if !bc.indexed {
+			db.byType = nil
+		}
+		s, err := NewServer(db, newTestConn(ble.MaxMTU))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(bc.name+"/ByUUID", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				discover(s, func(start uint16) []byte {
+					return pdu(FindByTypeValueRequestCode, start, uint16(0xFFFF), ble.PrimaryServiceUUID, uint16(0x1809))
+				}, func(rsp []byte) uint16 {
+					return binary.LittleEndian.Uint16(rsp[len(rsp)-2:])
+				})
+			}
+		})
+		b.Run(bc.name+"/All", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				discover(s, func(start uint16) []byte {
+					return pdu(ReadByGroupTypeRequestCode, start, uint16(0xFFFF), ble.PrimaryServiceUUID)
+				}, func(rsp []byte) uint16 {
+					return binary.LittleEndian.Uint16(rsp[len(rsp)-4:])
+				})
+			}
+		})
+	}
+}
+
+// BenchmarkFindInformation measures small-range Find Information Requests
+// on a 1000-attribute DB, which cost the same wherever the range is.
+func BenchmarkFindInformation(b *testing.B) {
+	var ss []*ble.Service
+	for i := 0; i < 200; i++ {
+		s := ble.NewService(ble.UUID16(0x1800 + uint16(i%10)))
+		s.NewCharacteristic(ble.UUID16(0x2A00)).SetValue([]byte{0x00})
+		s.NewCharacteristic(ble.UUID16(0x2A01)).SetValue([]byte{0x00})
+		ss = append(ss, s)
+	}
+	db := NewDB(ss, 1)
+	if len(db.attrs) != 1000 {
+		b.Fatalf("%d attributes, want 1000", len(db.attrs))
+	}
+	s, err := NewServer(db, newTestConn(ble.MaxMTU))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, start := range []uint16{0x0001, 500, 996} {
+		b.Run(fmt.Sprintf("0x%04X", start), func(b *testing.B) {
+			req := pdu(FindInformationRequestCode, start, start+4)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if rsp := s.ProcessRequest(req); rsp[0] != FindInformationResponseCode {
+					b.Fatalf("responded [% X]", rsp)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkNotifyBurst measures the throughput of bursts of 1000
+// notifications, each of which is written to the connection on its own.
+func BenchmarkNotifyBurst(b *testing.B) {
+	const burst = 1000
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {}))
+	dc := &discardConn{testConn: newTestConn(ble.MaxMTU), sent: make(chan int, burst)}
+	s, err := NewServer(NewDB([]*ble.Service{svc}, 1), dc)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, ble.DefaultMTU-3)
+	b.ReportAllocs()
+	b.SetBytes(burst * int64(len(data)))
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < burst; j++ {
+			if _, err := s.NotifyByUUID(false, ble.UUID16(0xFFF1), data); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for j := 0; j < burst; j++ {
+			<-dc.sent
+		}
+	}
+	b.ReportMetric(float64(b.N*burst)/time.Since(start).Seconds(), "notifications/s")
+}
@@ -0,0 +1,67 @@
+package att
+
+// MaxFindInfoEntries returns the number of handle-UUID pairs that fit in a
+// Find Information Response for the given ATT_MTU. The format is 0x01 for
+// 16-bit UUIDs, or 0x02 for 128-bit UUIDs. It returns 0 for other formats.
+// [Vol 3, Part F, 3.4.3.2]
+func MaxFindInfoEntries(mtu int, format byte) int {
+	n := 0
+	switch format {
+	case 0x01:
+		n = 2 + 2
+	case 0x02:
+		n = 2 + 16
+	default:
+		return 0
+	}
+	// opcode (1 byte) + format (1 byte)
+	if mtu < 2 {
+		return 0
+	}
+	return (mtu - 2) / n
+}
+
+// MaxReadByTypeEntries returns the number of handle-value pairs, with values
+// of valueLen bytes, that fit in a Read By Type Response for the given ATT_MTU.
+// Values longer than MaxReadByTypeValue are truncated by the server.
+// [Vol 3, Part F, 3.4.4.2]
+func MaxReadByTypeEntries(mtu, valueLen int) int {
+	// opcode (1 byte) + length (1 byte)
+	if mtu < 4 || valueLen < 0 {
+		return 0
+	}
+	// Each entry consists of a handle (2 bytes) and the value, and its length
+	// is limited to 255 bytes, as well as the space available in the PDU.
+	n := 2 + valueLen
+	if n > 255 {
+		n = 255
+	}
+	if n > mtu-2 {
+		n = mtu - 2
+	}
+	return (mtu - 2) / n
+}
+
+// MaxReadByTypeValue returns the maximum length of a value, which can be sent
+// in a Read By Type Response without being truncated. [Vol 3, Part F, 3.4.4.2]
+func MaxReadByTypeValue(mtu int) int {
+	n := mtu - 2 - 2
+	if n > 255-2 {
+		n = 255 - 2
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// MaxNotifyPayload returns the maximum length of a value, which can be sent
+// in a single Handle Value Notification or Indication for the given ATT_MTU.
+// [Vol 3, Part F, 3.4.7.1]
+func MaxNotifyPayload(mtu int) int {
+	// opcode (1 byte) + attribute handle (2 bytes)
+	if mtu < 3 {
+		return 0
+	}
+	return mtu - 3
+}
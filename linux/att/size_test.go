@@ -0,0 +1,98 @@
+package att
+
+import (
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestMaxFindInfoEntries(t *testing.T) {
+	// floor((ATT_MTU - 2) / (2 + UUID length)) [Vol 3, Part F, 3.4.3.2]
+	for _, tc := range []struct {
+		mtu    int
+		format byte
+		want   int
+	}{
+		{ble.DefaultMTU, 0x01, 5},
+		{ble.DefaultMTU, 0x02, 1},
+		{ble.MaxMTU, 0x01, 128},
+		{ble.MaxMTU, 0x02, 28},
+		{5, 0x01, 0},
+		{1, 0x01, 0},
+		{ble.DefaultMTU, 0x03, 0},
+	} {
+		if n := MaxFindInfoEntries(tc.mtu, tc.format); n != tc.want {
+			t.Errorf("MaxFindInfoEntries(%d, 0x%02X) = %d, want %d", tc.mtu, tc.format, n, tc.want)
+		}
+	}
+}
+
+func TestMaxReadByTypeEntries(t *testing.T) {
+	// floor((ATT_MTU - 2) / min(2 + value length, 255, ATT_MTU - 2))
+	// [Vol 3, Part F, 3.4.4.2]
+	for _, tc := range []struct {
+		mtu, valueLen, want int
+	}{
+		{ble.DefaultMTU, 0, 10},
+		{ble.DefaultMTU, 1, 7},
+		{ble.DefaultMTU, 19, 1},
+		{ble.DefaultMTU, 100, 1}, // Truncated to fill the PDU.
+		{ble.MaxMTU, 2, 128},
+		{ble.MaxMTU, 253, 2},
+		{ble.MaxMTU, 300, 2}, // Truncated to 255 bytes per entry.
+		{3, 1, 0},
+		{ble.DefaultMTU, -1, 0},
+	} {
+		if n := MaxReadByTypeEntries(tc.mtu, tc.valueLen); n != tc.want {
+			t.Errorf("MaxReadByTypeEntries(%d, %d) = %d, want %d", tc.mtu, tc.valueLen, n, tc.want)
+		}
+	}
+}
+
+func TestMaxReadByTypeValue(t *testing.T) {
+	// min(ATT_MTU - 4, 253) [Vol 3, Part F, 3.4.4.2]
+	for _, tc := range []struct {
+		mtu, want int
+	}{
+		{ble.DefaultMTU, 19},
+		{257, 253},
+		{ble.MaxMTU, 253},
+		{4, 0},
+		{3, 0},
+	} {
+		if n := MaxReadByTypeValue(tc.mtu); n != tc.want {
+			t.Errorf("MaxReadByTypeValue(%d) = %d, want %d", tc.mtu, n, tc.want)
+		}
+	}
+}
+
+func TestMaxNotifyPayload(t *testing.T) {
+	// ATT_MTU - 3 [Vol 3, Part F, 3.4.7.1]
+	for _, tc := range []struct {
+		mtu, want int
+	}{
+		{ble.DefaultMTU, 20},
+		{ble.MaxMTU, ble.MaxMTU - 3},
+		{3, 0},
+		{2, 0},
+	} {
+		if n := MaxNotifyPayload(tc.mtu); n != tc.want {
+			t.Errorf("MaxNotifyPayload(%d) = %d, want %d", tc.mtu, n, tc.want)
+		}
+	}
+}
+
+// TestSizesServed checks the sizes against the responses of a Server.
+func TestSizesServed(t *testing.T) {
+	s, c := newTestServer(t, testServices())
+	b := c.request(t, pdu(FindInformationRequestCode, uint16(0x0001), uint16(0xFFFF)))
+	if n := (len(b) - 2) / 4; n != MaxFindInfoEntries(ble.DefaultMTU, 0x01) {
+		t.Errorf("Find Information Response of %d entries, want %d", n, MaxFindInfoEntries(ble.DefaultMTU, 0x01))
+	}
+	if _, err := s.NotifyByUUID(false, ble.AppearanceUUID, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.recv(t); len(b)-3 != MaxNotifyPayload(ble.DefaultMTU) {
+		t.Errorf("notified %d bytes, want %d", len(b)-3, MaxNotifyPayload(ble.DefaultMTU))
+	}
+}
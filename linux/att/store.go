@@ -0,0 +1,52 @@
+package att
+
+import "github.com/currantlabs/ble"
+
+// A Store provides the attributes of a DB, in place of the ones kept in
+// memory, e.g. from a read-only table in flash. Only the attributes visited
+// by each request are materialized. The handles of the attributes must be
+// contiguous from the base of the DB.
+type Store interface {
+	// Len returns the number of attributes.
+	Len() int
+
+	// Attribute returns the i-th attribute, whose handle is the base of the
+	// DB plus i.
+	Attribute(i int) Attribute
+}
+
+// An Attribute is an attribute provided by a Store.
+type Attribute struct {
+	Handle    uint16
+	EndHandle uint16 // End Group Handle of a service declaration.
+	Type      ble.UUID
+
+	// Value is the static value. Otherwise, the value is served by the
+	// ReadHandler, or the DefaultReadHandler of the Server.
+	Value        []byte
+	ReadHandler  ble.ReadHandler
+	WriteHandler ble.WriteHandler
+
+	Hidden    bool // Omitted from discovery responses.
+	WriteOnly bool // Responded with ErrReadNotPerm to reads.
+}
+
+func (a Attribute) attr() *attr {
+	return &attr{
+		h:         a.Handle,
+		endh:      a.EndHandle,
+		typ:       a.Type,
+		v:         a.Value,
+		rh:        a.ReadHandler,
+		wh:        a.WriteHandler,
+		hidden:    a.Hidden,
+		writeOnly: a.WriteOnly,
+	}
+}
+
+// NewStoreDB returns a DB of the attributes provided by st, whose handles
+// start from base. As the DB isn't built from services, it can't be merged
+// or rebased.
+func NewStoreDB(st Store, base uint16) *DB {
+	return &DB{store: st, base: base}
+}
@@ -0,0 +1,62 @@
+package att
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+// tableStore is a Store over a table of attributes, which counts the
+// attributes materialized.
+type tableStore struct {
+	aa []Attribute
+	n  int
+}
+
+func (s *tableStore) Len() int { return len(s.aa) }
+
+func (s *tableStore) Attribute(i int) Attribute {
+	s.n++
+	return s.aa[i]
+}
+
+func TestStoreDB(t *testing.T) {
+	st := &tableStore{aa: []Attribute{
+		{Handle: 0x0010, EndHandle: 0xFFFF, Type: ble.PrimaryServiceUUID, Value: ble.BatteryUUID},
+		{Handle: 0x0011, Type: ble.CharacteristicUUID, Value: CharacteristicDeclaration(ble.CharRead, 0x0012, ble.BatteryLevelUUID)},
+		{Handle: 0x0012, Type: ble.BatteryLevelUUID, ReadHandler: ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+			rsp.Write([]byte{77})
+		})},
+	}}
+	c := newTestConn(ble.MaxMTU)
+	s, err := NewServer(NewStoreDB(st, 0x0010), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Loop()
+	defer c.Close()
+
+	for _, tc := range []struct {
+		req  []byte
+		want []byte
+		n    int // Number of attributes materialized.
+	}{
+		{pdu(ReadRequestCode, uint16(0x0012)), pdu(ReadResponseCode, 77), 1},
+		{pdu(ReadRequestCode, uint16(0x0013)), newErrorResponse(ReadRequestCode, 0x0013, ble.ErrInvalidHandle), 0},
+		{pdu(ReadByGroupTypeRequestCode, uint16(0x0001), uint16(0xFFFF), ble.PrimaryServiceUUID),
+			pdu(ReadByGroupTypeResponseCode, 6, uint16(0x0010), uint16(0xFFFF), ble.BatteryUUID), 3},
+		{pdu(ReadByTypeRequestCode, uint16(0x0011), uint16(0x0012), ble.CharacteristicUUID),
+			pdu(ReadByTypeResponseCode, 7, uint16(0x0011), CharacteristicDeclaration(ble.CharRead, 0x0012, ble.BatteryLevelUUID)), 2},
+		{pdu(FindInformationRequestCode, uint16(0x0012), uint16(0xFFFF)),
+			pdu(FindInformationResponseCode, 0x01, uint16(0x0012), ble.BatteryLevelUUID), 1},
+	} {
+		st.n = 0
+		if b := c.request(t, tc.req); !bytes.Equal(b, tc.want) {
+			t.Errorf("% X responded % X, want % X", tc.req, b, tc.want)
+		}
+		if st.n != tc.n {
+			t.Errorf("% X materialized %d attributes, want %d", tc.req, st.n, tc.n)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package att
+
+import (
+	"sync"
+
+	"github.com/currantlabs/ble"
+)
+
+// Values stores the application data scoped to the connection of a Server,
+// such as the authentication status, or the subscriptions. It's cleared when
+// the connection is closed, or the Loop ends.
+// Values is safe for concurrent use.
+type Values struct {
+	mu sync.Mutex
+	m  map[interface{}]interface{}
+}
+
+// Get returns the value stored for key, and whether it's found.
+func (v *Values) Get(key interface{}) (interface{}, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	val, ok := v.m[key]
+	return val, ok
+}
+
+// Set stores val for key, replacing the existing one.
+func (v *Values) Set(key, val interface{}) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.m == nil {
+		v.m = make(map[interface{}]interface{})
+	}
+	v.m[key] = val
+}
+
+// Delete removes the value stored for key, if any.
+func (v *Values) Delete(key interface{}) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.m, key)
+}
+
+// Len returns the number of values stored.
+func (v *Values) Len() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.m)
+}
+
+// clear removes all the values stored.
+func (v *Values) clear() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.m = nil
+}
+
+// ValuesOf returns the Values of the Server serving c, which is the
+// connection of the requests passed to the handlers. It returns nil,
+// if c isn't served by a Server of this package.
+func ValuesOf(c ble.Conn) *Values {
+	cn, ok := c.(*conn)
+	if !ok {
+		return nil
+	}
+	return &cn.svr.values
+}
@@ -0,0 +1,78 @@
+package att
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/currantlabs/ble"
+)
+
+func TestValues(t *testing.T) {
+	var v Values
+	if _, ok := v.Get("missing"); ok || v.Len() != 0 {
+		t.Fatal("zero Values isn't empty")
+	}
+	v.Delete("missing")
+	v.Set("auth", true)
+	v.Set("version", 1)
+	v.Set("version", 2)
+	if val, ok := v.Get("version"); !ok || val != 2 || v.Len() != 2 {
+		t.Errorf("version %v %t, %d values, want 2 true, 2 values", val, ok, v.Len())
+	}
+	v.Delete("auth")
+	if _, ok := v.Get("auth"); ok || v.Len() != 1 {
+		t.Errorf("auth not deleted")
+	}
+	if ValuesOf(newTestConn(ble.MaxMTU)) != nil {
+		t.Error("Values of a connection not served")
+	}
+}
+
+func TestValuesLifecycle(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0xFFF0))
+	svc.NewCharacteristic(ble.UUID16(0xFFF1)).HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		val, _ := ValuesOf(req.Conn()).Get("version")
+		rsp.Write([]byte{val.(byte)})
+	}))
+	svc.NewCharacteristic(ble.UUID16(0xFFF2)).HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		ValuesOf(req.Conn()).Set("version", req.Data()[0])
+	}))
+
+	// The values are shared by the handlers, and the application.
+	s, c := newTestServer(t, []*ble.Service{svc})
+	s.Values().Set("version", byte(1))
+	if b, want := c.request(t, pdu(ReadRequestCode, uint16(0x0003))), pdu(ReadResponseCode, 0x01); !bytes.Equal(b, want) {
+		t.Fatalf("read: got [% X], want [% X]", b, want)
+	}
+	c.request(t, pdu(WriteRequestCode, uint16(0x0005), 0x02))
+	if val, _ := s.Values().Get("version"); val != byte(2) {
+		t.Errorf("version %v, want 2", val)
+	}
+
+	// Closing the connection ends the Loop, which clears them.
+	c = newTestConn(ble.MaxMTU)
+	s, err := NewServer(NewDB([]*ble.Service{svc}, 1), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Loop()
+		close(done)
+	}()
+	<-s.Started()
+	s.Values().Set("version", byte(1))
+	c.Close()
+	<-done
+	if n := s.Values().Len(); n != 0 {
+		t.Errorf("%d values after the Loop ended", n)
+	}
+
+	// So does Close.
+	s, _ = newTestServer(t, []*ble.Service{svc})
+	s.Values().Set("version", byte(1))
+	s.Close()
+	if n := s.Values().Len(); n != 0 {
+		t.Errorf("%d values after Close", n)
+	}
+}
@@ -186,8 +186,44 @@ func (c *Conn) Write(sdu []byte) (int, error) {
 	return sent, nil
 }
 
+// WriteBuffers writes the concatenation of v as a single L2CAP SDU.
+// The L2CAP header and the buffers are copied straight into the ACL data
+// packets, so the SDU is never assembled in an intermediate buffer.
+func (c *Conn) WriteBuffers(v [][]byte) (int, error) {
+	slen := 0
+	for _, b := range v {
+		slen += len(b)
+	}
+	if slen > c.txMTU {
+		return 0, errors.Wrap(io.ErrShortWrite, "payload exceeds mtu")
+	}
+	hlen := 4
+	if c.leFrame {
+		hlen = 6
+	}
+	var hdr [6]byte
+	binary.LittleEndian.PutUint16(hdr[0:2], uint16(slen))
+	binary.LittleEndian.PutUint16(hdr[2:4], cidLEAtt)
+	if c.leFrame {
+		binary.LittleEndian.PutUint16(hdr[4:6], uint16(slen))
+	}
+	return c.writeFragments(hdr[:hlen], v)
+}
+
 // writePDU breaks down a L2CAP PDU into fragments if it's larger than the HCI buffer size. [Vol 3, Part A, 7.2.1]
 func (c *Conn) writePDU(pdu []byte) (int, error) {
+	return c.writeFragments(pdu, nil)
+}
+
+// writeFragments writes the concatenation of the L2CAP PDU header hdr, and
+// the payload v, as writePDU does, but without assembling them beforehand.
+func (c *Conn) writeFragments(hdr []byte, v [][]byte) (int, error) {
+	plen := len(hdr)
+	for _, b := range v {
+		plen += len(b)
+	}
+	next := hdr // The part of the PDU to be sent next.
+
 	sent := 0
 	flags := uint16(pbfHostToControllerStart << 4) // ACL boundary flags
 
@@ -197,10 +233,10 @@ func (c *Conn) writePDU(pdu []byte) (int, error) {
 	c.txBuffer.LockPool()
 	defer c.txBuffer.UnlockPool()
 
-	for len(pdu) > 0 {
+	for plen > 0 {
 		// Get a buffer from our pre-allocated and flow-controlled pool.
 		pkt := c.txBuffer.Get() // ACL pkt
-		flen := len(pdu)        // fragment length
+		flen := plen            // fragment length
 		if flen > pkt.Cap()-1-4 {
 			flen = pkt.Cap() - 1 - 4
 		}
@@ -209,7 +245,19 @@ func (c *Conn) writePDU(pdu []byte) (int, error) {
 		binary.Write(pkt, binary.LittleEndian, uint8(pktTypeACLData))                         // HCI Header: pkt Type
 		binary.Write(pkt, binary.LittleEndian, uint16(c.param.ConnectionHandle()|(flags<<8))) // ACL Header: handle and flags
 		binary.Write(pkt, binary.LittleEndian, uint16(flen))                                  // ACL Header: data len
-		binary.Write(pkt, binary.LittleEndian, pdu[:flen])                                    // Append payload
+
+		// Append payload, which may span the header and multiple buffers.
+		for m := flen; m > 0; {
+			for len(next) == 0 {
+				next, v = v[0], v[1:]
+			}
+			l := len(next)
+			if l > m {
+				l = m
+			}
+			pkt.Write(next[:l])
+			next, m = next[l:], m-l
+		}
 
 		// Flush the pkt to HCI
 		select {
@@ -222,9 +270,9 @@ func (c *Conn) writePDU(pdu []byte) (int, error) {
 			return sent, err
 		}
 		sent += flen
+		plen -= flen
 
 		flags = (pbfContinuing << 4) // Set "continuing" in the boundary flags for the rest of fragments, if any.
-		pdu = pdu[flen:]             // Advence the point
 	}
 	return sent, nil
 }
@@ -295,10 +343,10 @@ func (c *Conn) Close() error {
 // LocalAddr returns local device's MAC address.
 func (c *Conn) LocalAddr() ble.Addr { return c.hci.Addr() }
 
-// RemoteAddr returns remote device's MAC address.
+// RemoteAddr returns remote device's MAC address, which is comparable.
 func (c *Conn) RemoteAddr() ble.Addr {
 	a := c.param.PeerAddress()
-	return net.HardwareAddr([]byte{a[5], a[4], a[3], a[2], a[1], a[0]})
+	return ble.NewAddr(net.HardwareAddr([]byte{a[5], a[4], a[3], a[2], a[1], a[0]}).String())
 }
 
 // RxMTU returns the MTU which the upper layer is capable of accepting.
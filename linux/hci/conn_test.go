@@ -0,0 +1,85 @@
+package hci
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/currantlabs/ble"
+	"github.com/currantlabs/ble/linux/hci/evt"
+)
+
+// recordSkt is an HCI socket, which records the packets written.
+type recordSkt struct {
+	pkts [][]byte
+	keep bool
+}
+
+func (s *recordSkt) Read(b []byte) (int, error) { return 0, nil }
+func (s *recordSkt) Close() error               { return nil }
+
+func (s *recordSkt) Write(b []byte) (int, error) {
+	if s.keep {
+		s.pkts = append(s.pkts, append([]byte{}, b...))
+	}
+	return len(b), nil
+}
+
+// newTestConn returns a Conn of handle 0x0040, which sends ACL data packets
+// of up to 27 bytes of payload to skt.
+func newTestConn(skt *recordSkt) *Conn {
+	h := &HCI{skt: skt, pool: NewPool(1+4+27, 32)}
+	param := make(evt.LEConnectionComplete, 19)
+	param[1] = 0x40
+	return &Conn{
+		hci:      h,
+		param:    param,
+		txMTU:    ble.MaxMTU,
+		txBuffer: NewClient(h.pool),
+		chDone:   make(chan struct{}),
+	}
+}
+
+func TestWriteBuffers(t *testing.T) {
+	v := make([]byte, 60)
+	for i := range v {
+		v[i] = byte(i)
+	}
+	skt1, skt2 := &recordSkt{keep: true}, &recordSkt{keep: true}
+	if _, err := newTestConn(skt1).Write(append([]byte{0x0B}, v...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestConn(skt2).WriteBuffers([][]byte{{0x0B}, v[:10], nil, v[10:]}); err != nil {
+		t.Fatal(err)
+	}
+	if len(skt1.pkts) != 3 {
+		t.Fatalf("Write sent %d packets, want 3", len(skt1.pkts))
+	}
+	for i := range skt1.pkts {
+		if i >= len(skt2.pkts) || !bytes.Equal(skt1.pkts[i], skt2.pkts[i]) {
+			t.Fatalf("WriteBuffers sent\n% X\nwant\n% X", skt2.pkts, skt1.pkts)
+		}
+	}
+}
+
+func BenchmarkWriteLargeSDU(b *testing.B) {
+	v := make([]byte, ble.MaxMTU-1)
+	for _, bc := range []struct {
+		name  string
+		write func(c *Conn) (int, error)
+	}{
+		{"Write", func(c *Conn) (int, error) { return c.Write(append([]byte{0x0B}, v...)) }},
+		{"WriteBuffers", func(c *Conn) (int, error) { return c.WriteBuffers([][]byte{{0x0B}, v}) }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c := newTestConn(&recordSkt{})
+			b.ReportAllocs()
+			b.SetBytes(ble.MaxMTU)
+			for i := 0; i < b.N; i++ {
+				if _, err := bc.write(c); err != nil {
+					b.Fatal(err)
+				}
+				c.txBuffer.PutAll()
+			}
+		})
+	}
+}
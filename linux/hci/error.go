@@ -9,6 +9,8 @@ var (
 	ErrBusyDialing     = errors.New("busy dialing")
 	ErrBusyListening   = errors.New("busy listening")
 	ErrInvalidAddr     = errors.New("invalid address")
+
+	ErrConnParamsRejected = errors.New("connection parameters rejected")
 )
 
 // HCI Command Errors  [Vol2, Part D, 1.3 ]
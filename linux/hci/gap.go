@@ -14,7 +14,7 @@ import (
 )
 
 // Addr ...
-func (h *HCI) Addr() ble.Addr { return h.addr }
+func (h *HCI) Addr() ble.Addr { return ble.NewAddr(h.addr.String()) }
 
 // SetAdvHandler ...
 func (h *HCI) SetAdvHandler(ah ble.AdvHandler) error {
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/currantlabs/ble"
 	"github.com/currantlabs/ble/linux/hci/cmd"
 )
 
@@ -49,7 +50,12 @@ func (c *Conn) Signal(req Signal, rsp Signal) error {
 		return errors.New("signaling request timed out")
 	}
 
-	if s.code() != req.Code() {
+	// Requests are responded with a different code; compare against the expected one.
+	code := req.Code()
+	if rsp != nil {
+		code = rsp.Code()
+	}
+	if s.code() != code {
 		return errors.New("mismatched signaling response")
 	}
 	if s.id() != c.sigID {
@@ -212,6 +218,30 @@ func (c *Conn) handleConnectionParameterUpdateRequest(s sigCmd) {
 		})
 }
 
+// RequestConnectionParameterUpdate sends a Connection Parameter Update Request
+// to the master, and waits for the result. [Vol 3, Part A, 4.20 & 4.21]
+// It returns ErrConnParamsRejected if the master rejects the parameters.
+func (c *Conn) RequestConnectionParameterUpdate(p ble.ConnParams) error {
+	// This command shall only be sent from the LE slave device to the LE master device.
+	if c.param.Role() != roleSlave {
+		return errors.New("connection parameter update can only be requested by slave")
+	}
+	var rsp ConnectionParameterUpdateResponse
+	err := c.Signal(&ConnectionParameterUpdateRequest{
+		IntervalMin:       p.IntervalMin,
+		IntervalMax:       p.IntervalMax,
+		SlaveLatency:      p.SlaveLatency,
+		TimeoutMultiplier: p.TimeoutMultiplier,
+	}, &rsp)
+	if err != nil {
+		return err
+	}
+	if rsp.Result != 0 {
+		return ErrConnParamsRejected
+	}
+	return nil
+}
+
 // LECreditBasedConnectionRequest ...
 func (c *Conn) LECreditBasedConnectionRequest(s sigCmd) {
 	// TODO:
@@ -19,6 +19,9 @@ var (
 
 var cnt = 0
 
+// variable is set when the PDU being generated has a variable-length field.
+var variable = false
+
 var funcMap = template.FuncMap{
 	"esc": func(s string) string {
 		s = strings.Replace(s, " ", "", -1)
@@ -28,58 +31,82 @@ var funcMap = template.FuncMap{
 	},
 	"reset": func() string {
 		cnt = 0
+		variable = false
 		return ""
 	},
-	"roy": func(n, c, k, v string) string {
+	"parser": func(n, c string) string {
+		cond := fmt.Sprintf("len(b) != %d", cnt)
+		desc := fmt.Sprintf("isn't %d bytes long", cnt)
+		if variable {
+			cond = fmt.Sprintf("len(b) < %d", cnt)
+			desc = fmt.Sprintf("is shorter than %d bytes", cnt)
+		}
+		s := fmt.Sprintf("// New%s validates the length and opcode of b, and returns it as %s.\n", n, n)
+		s += fmt.Sprintf("// It returns ble.ErrInvalidPDU if b %s, or the opcode isn't %s.\n", desc, c)
+		s += fmt.Sprintf("func New%s(b []byte) (%s, error) {\n", n, n)
+		s += fmt.Sprintf("if %s || b[0] != %s {\n", cond, c)
+		s += "return nil, ble.ErrInvalidPDU\n"
+		s += "}\n"
+		s += fmt.Sprintf("return %s(b), nil\n", n)
+		s += "}\n"
+		return s
+	},
+	"roy": func(n, c, k, v, name string) string {
 		var s string
+		if v == "[]byte" {
+			variable = true
+		}
+		get := fmt.Sprintf("// %s returns the %s field.\n", k, name)
+		set := fmt.Sprintf("// Set%s sets the %s field.\n", k, name)
 		switch v {
 		case "uint8":
-			s += fmt.Sprintf("// %s ...\n", k)
+			s += get
 			s += fmt.Sprintf("func (r %s) %s () %s { return r[%d]}\n", n, k, v, cnt)
-			s += fmt.Sprintf("// Set%s ...\n", k)
 			if k == "AttributeOpcode" {
+				s += fmt.Sprintf("// Set%s sets the %s field to %s.\n", k, name, c)
 				s += fmt.Sprintf("func (r %s) Set%s () { r[%d] = %s}", n, k, cnt, c)
 			} else {
+				s += set
 				s += fmt.Sprintf("func (r %s) Set%s (v %s) { r[%d] = v}", n, k, v, cnt)
 			}
 			cnt++
 		case "uint16":
-			s += fmt.Sprintf("// %s ...\n", k)
+			s += get
 			s += fmt.Sprintf("func (r %s) %s () %s { return binary.LittleEndian.Uint16(r[%d:])}\n", n, k, v, cnt)
-			s += fmt.Sprintf("// Set%s ...\n", k)
+			s += set
 			s += fmt.Sprintf("func (r %s) Set%s (v %s) { binary.LittleEndian.PutUint16(r[%d:], v)}", n, k, v, cnt)
 			cnt += 2
 		case "uint64":
-			s += fmt.Sprintf("// %s ...\n", k)
+			s += get
 			s += fmt.Sprintf("func (r %s) %s () %s { return binary.LittleEndian.Uint64(r[%d:])}\n", n, k, v, cnt)
-			s += fmt.Sprintf("// Set%s ...\n", k)
+			s += set
 			s += fmt.Sprintf("func (r %s) Set%s (v %s) { binary.LittleEndian.PutUint64(r[%d:], v)}", n, k, v, cnt)
 			cnt += 8
 		case "[]byte":
-			s += fmt.Sprintf("// %s ...\n", k)
+			s += get
 			s += fmt.Sprintf("func (r %s) %s () %s { return r[%d:]}\n", n, k, v, cnt)
-			s += fmt.Sprintf("// Set%s ...\n", k)
+			s += set
 			s += fmt.Sprintf("func (r %s) Set%s (v %s) { copy(r[%d:], v)}", n, k, v, cnt)
 		case "[6]byte":
-			s += fmt.Sprintf("// %s ...\n", k)
+			s += get
 			s += fmt.Sprintf(`func (r %s) %s () %s {
 				 b:=[6]byte{}
 				 copy(b[:], r[%d:])
 				 return b
 				 }
 				 `, n, k, v, cnt)
-			s += fmt.Sprintf("// Set%s ...\n", k)
+			s += set
 			s += fmt.Sprintf(`func (r %s) Set%s (v %s) { copy(r[%d:%d+6], v[:]) }`, n, k, v, cnt, cnt)
 			cnt += 6
 		case "[12]byte":
-			s += fmt.Sprintf("// %s ...\n", k)
+			s += get
 			s += fmt.Sprintf(`func (r %s) %s () %s {
 				 b:=[12]byte{}
 				 copy(b[:], r[%d:])
 				 return b
 				 }
 				 `, n, k, v, cnt)
-			s += fmt.Sprintf("// Set%s ...\n", k)
+			s += set
 			s += fmt.Sprintf(`func (r %s) Set%s (v %s) { copy(r[%d:%d+12], v[:]) }`, n, k, v, cnt, cnt)
 			cnt += 12
 		default:
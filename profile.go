@@ -72,6 +72,10 @@ type Service struct {
 	UUID            UUID
 	Characteristics []*Characteristic
 
+	// Includes are the services included by the service, which must be served
+	// along with it. [Vol 3, Part G, 3.2]
+	Includes []*Service
+
 	Handle    uint16
 	EndHandle uint16
 }
@@ -109,6 +113,10 @@ type Characteristic struct {
 	NotifyHandler   NotifyHandler
 	IndicateHandler NotifyHandler
 
+	// Hidden excludes the characteristic, including its declaration and
+	// descriptors, from discovery. The attributes remain accessible by handle.
+	Hidden bool
+
 	Handle      uint16
 	ValueHandle uint16
 	EndHandle   uint16
@@ -187,6 +195,10 @@ type Descriptor struct {
 
 	ReadHandler  ReadHandler
 	WriteHandler WriteHandler
+
+	// Hidden excludes the descriptor from discovery.
+	// The attribute remains accessible by handle.
+	Hidden bool
 }
 
 // SetValue makes the descriptor support read requests, and returns a static value.
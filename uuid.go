@@ -97,8 +97,12 @@ func Reverse(u []byte) []byte {
 }
 
 // Name returns name of know services, characteristics, or descriptors.
+// Name returns the UUID as a string, if it's unknown.
 func Name(u UUID) string {
-	return knownUUID[u.String()].Name
+	if k, ok := knownUUID[u.String()]; ok {
+		return k.Name
+	}
+	return u.String()
 }
 
 // A dictionary of known service names and type (keyed by service uuid)
@@ -214,4 +218,7 @@ var knownUUID = map[string]struct{ Name, Type string }{
 	"2a5b": {Name: "CSC Measurement", Type: "org.bluetooth.characteristic.csc_measurement"},
 	"2a5c": {Name: "CSC Feature", Type: "org.bluetooth.characteristic.csc_feature"},
 	"2a5d": {Name: "Sensor Location", Type: "org.bluetooth.characteristic.sensor_location"},
+	"2b29": {Name: "Client Supported Features", Type: "org.bluetooth.characteristic.client_supported_features"},
+	"2b2a": {Name: "Database Hash", Type: "org.bluetooth.characteristic.database_hash"},
+	"2b3a": {Name: "Server Supported Features", Type: "org.bluetooth.characteristic.server_supported_features"},
 }
@@ -0,0 +1,19 @@
+package ble
+
+import "testing"
+
+func TestName(t *testing.T) {
+	for _, tc := range []struct {
+		u    UUID
+		want string
+	}{
+		{PrimaryServiceUUID, "Primary Service"},
+		{ClientCharacteristicConfigUUID, "Client Characteristic Configuration"},
+		{UUID16(0xFFF0), "fff0"},
+		{MustParse("34DA3AD1-7110-41A1-B1EF-4430F509CDE7"), "34da3ad1711041a1b1ef4430f509cde7"},
+	} {
+		if got := Name(tc.u); got != tc.want {
+			t.Errorf("Name(%s) = %q, want %q", tc.u, got, tc.want)
+		}
+	}
+}